@@ -0,0 +1,276 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+	"strings"
+)
+
+// kinds of actions of a plan
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+	ActionClose     = "close"
+	ActionUnmanaged = "unmanaged"
+)
+
+// Plan lists the actions required to bring yakuake in line with a profile
+type Plan struct {
+	Profile string       `json:"profile"`
+	Prune   bool         `json:"prune"`
+	Force   bool         `json:"force"`
+	Actions []PlanAction `json:"actions"`
+}
+
+// PlanAction is the action planned for a single tab of the profile or an existing session
+type PlanAction struct {
+	Action    string          `json:"action"`
+	SessionID int             `json:"sessionId"`
+	Title     string          `json:"title"`
+	NewTitle  string          `json:"newTitle,omitempty"`
+	Protected bool            `json:"protected,omitempty"`
+	Changes   []FlagChange    `json:"changes,omitempty"`
+	Tab       *TabDescription `json:"-"`
+}
+
+// FlagChange is a flag of an existing session that differs from the profile, named like in the configuration
+type FlagChange struct {
+	Flag string `json:"flag"`
+	From bool   `json:"from"`
+	To   bool   `json:"to"`
+}
+
+// state of an existing session, flags are expressed like in a TabDescription
+type sessionState struct {
+	ID                   int
+	Title                string
+	Terminals            []int
+	Protected            bool
+	MonitorSilence       bool
+	MonitorActivity      bool
+	DisableKeyboardInput bool
+}
+
+// ApplyProfile opens only the tabs of a profile which are missing and updates the flags of existing ones.
+// Tabs are matched by title. With prune, sessions not described by the profile are closed.
+func ApplyProfile(configuration *YakCtlConfiguration, profileName string, variables map[string]string, prune bool, force bool) error {
+	profile, err := getRenderedProfile(configuration, profileName, variables)
+	if err != nil {
+		return err
+	}
+	if err := checkVariablesDeclared([]*ProfileDescription{profile}, variables); err != nil {
+		return err
+	}
+	if err := checkWorkdirs(profile); err != nil {
+		return err
+	}
+	plan, err := PlanProfile(profile, prune || profile.ClearAll, force || profile.ForceClear)
+	if err != nil {
+		return err
+	}
+	return ApplyPlan(plan)
+}
+
+// PlanProfile compares the existing sessions with a profile without changing anything
+func PlanProfile(profile *ProfileDescription, prune bool, force bool) (*Plan, error) {
+	states, err := readSessionStates()
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{Profile: profile.Name, Prune: prune, Force: force}
+	matches := matchTabs(profile.Tabs, states)
+	matched := map[int]bool{}
+	for _, state := range matches {
+		if state != nil {
+			matched[state.ID] = true
+		}
+	}
+
+	for i := range profile.Tabs {
+		tab := &profile.Tabs[i]
+		state := matches[i]
+		if state == nil {
+			plan.Actions = append(plan.Actions, PlanAction{Action: ActionCreate, SessionID: -1, Title: tab.Name, Tab: tab})
+			continue
+		}
+		action := PlanAction{Action: ActionUnchanged, SessionID: state.ID, Title: state.Title, Protected: state.Protected, Tab: tab}
+		if state.Title != tab.Name {
+			action.NewTitle = tab.Name
+		}
+		action.Changes = flagChanges(state, tab)
+		if len(action.NewTitle) > 0 || len(action.Changes) > 0 {
+			action.Action = ActionUpdate
+		}
+		plan.Actions = append(plan.Actions, action)
+	}
+
+	for _, state := range states {
+		if matched[state.ID] {
+			continue
+		}
+		action := PlanAction{Action: ActionUnmanaged, SessionID: state.ID, Title: state.Title, Protected: state.Protected}
+		if prune && (!state.Protected || force) {
+			action.Action = ActionClose
+		}
+		plan.Actions = append(plan.Actions, action)
+	}
+	return plan, nil
+}
+
+// ApplyPlan performs the actions of a plan
+func ApplyPlan(plan *Plan) error {
+	currentlyOpenedSessionID := getCurrentSessionID()
+	var terminalsToClose []int
+
+	for _, action := range plan.Actions {
+		switch action.Action {
+		case ActionCreate:
+			if _, err := openTab(action.Tab); err != nil {
+				return err
+			}
+		case ActionUpdate:
+			if len(action.NewTitle) > 0 {
+				warnOnError(yakuake.SetTabTitle(action.SessionID, action.NewTitle))
+			}
+			for _, change := range action.Changes {
+				warnOnError(setSessionFlag(action.SessionID, change.Flag, change.To))
+			}
+			color.Success.Printf("Updated session #%d ('%s')\n", action.SessionID, action.Tab.Name)
+		case ActionClose:
+			terminalsToClose = append(terminalsToClose, getTerminalIDsForSessionID(action.SessionID)...)
+		}
+	}
+
+	// toggle window
+	if !isWindowShown() {
+		warnOnError(yakuake.ToggleWindowState())
+	}
+
+	if len(terminalsToClose) > 0 && clearSessions(plan.Force, terminalsToClose, &currentlyOpenedSessionID) {
+		color.Success.Println("All sessions cleared!")
+	}
+	return nil
+}
+
+// read title and flags of all existing sessions
+func readSessionStates() ([]sessionState, error) {
+	sessionIDs, err := getAllSessionIDs()
+	if err != nil {
+		return nil, err
+	}
+	var states []sessionState
+	for _, sessionID := range sessionIDs {
+		state := sessionState{ID: sessionID}
+		if state.Title, err = yakuake.TabTitle(sessionID); err != nil {
+			return nil, err
+		}
+		if state.Terminals, err = yakuake.TerminalIDsForSessionID(sessionID); err != nil {
+			return nil, err
+		}
+		closable, err := yakuake.IsSessionClosable(sessionID)
+		if err != nil {
+			return nil, err
+		}
+		state.Protected = !closable
+		if state.MonitorSilence, err = yakuake.IsSessionMonitorSilenceEnabled(sessionID); err != nil {
+			return nil, err
+		}
+		if state.MonitorActivity, err = yakuake.IsSessionMonitorActivityEnabled(sessionID); err != nil {
+			return nil, err
+		}
+		keyboardInputEnabled, err := yakuake.IsSessionKeyboardInputEnabled(sessionID)
+		if err != nil {
+			return nil, err
+		}
+		state.DisableKeyboardInput = !keyboardInputEnabled
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// the existing session of each tab, nil if there is none.
+// Exact titles are matched first, so a similar title does not steal the session of another tab.
+func matchTabs(tabs []TabDescription, states []sessionState) []*sessionState {
+	matches := make([]*sessionState, len(tabs))
+	matched := map[int]bool{}
+	for _, exact := range []bool{true, false} {
+		for i, tab := range tabs {
+			if matches[i] != nil {
+				continue
+			}
+			for j := range states {
+				if !matched[states[j].ID] && titleMatches(states[j].Title, tab.Name, exact) {
+					matches[i] = &states[j]
+					matched[states[j].ID] = true
+					break
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// titles match exactly or, in the second pass, ignoring case and surrounding whitespace
+func titleMatches(title string, name string, exact bool) bool {
+	if exact {
+		return title == name
+	}
+	return strings.EqualFold(strings.TrimSpace(title), strings.TrimSpace(name))
+}
+
+// list the flags of a session which differ from the tab
+func flagChanges(state *sessionState, tab *TabDescription) []FlagChange {
+	var changes []FlagChange
+	flags := []struct {
+		name    string
+		current bool
+		wanted  bool
+	}{
+		{"protected", state.Protected, tab.Protected},
+		{"monitorSilence", state.MonitorSilence, tab.MonitorSilence},
+		{"monitorActivity", state.MonitorActivity, tab.MonitorActivity},
+		{"disableInput", state.DisableKeyboardInput, tab.DisableKeyboardInput},
+	}
+	for _, flag := range flags {
+		if flag.current != flag.wanted {
+			changes = append(changes, FlagChange{Flag: flag.name, From: flag.current, To: flag.wanted})
+		}
+	}
+	return changes
+}
+
+// set a flag of a session by its configuration name
+func setSessionFlag(sessionID int, flag string, value bool) error {
+	switch flag {
+	case "protected":
+		return yakuake.SetSessionClosable(sessionID, !value)
+	case "monitorSilence":
+		return yakuake.SetSessionMonitorSilenceEnabled(sessionID, value)
+	case "monitorActivity":
+		return yakuake.SetSessionMonitorActivityEnabled(sessionID, value)
+	case "disableInput":
+		return yakuake.SetSessionKeyboardInputEnabled(sessionID, !value)
+	default:
+		return fmt.Errorf("unknown flag '%s'", flag)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const applyTestConfig = `
+profiles:
+  - name: work
+    tabs:
+      - name: editor
+        protected: true
+      - name: logs
+        split: lr
+        monitorActivity: true
+        commands:
+          - tail -f /var/log/syslog
+`
+
+func TestApplyProfileIsIdempotent(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	configuration := readTestConfig(t, applyTestConfig)
+
+	for i := 0; i < 2; i++ {
+		if err := ApplyProfile(configuration, "work", nil, false, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessions := fake.Sessions()
+	if len(sessions) != 3 {
+		t.Fatalf("expected the existing and two new sessions, got\n%s", fake)
+	}
+	logs := sessionByTitle(t, fake, "logs")
+	if commands := fake.Commands(logs.Terminals[0]); len(commands) != 1 {
+		t.Errorf("commands of existing tabs must not run again: %v", commands)
+	}
+}
+
+func TestApplyProfileUpdatesFlags(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	editorID, _ := fake.AddSession()
+	_ = fake.SetTabTitle(editorID, "Editor ")
+	_ = fake.SetSessionMonitorSilenceEnabled(editorID, true)
+	logsID, _ := fake.AddSessionTwoHorizontal()
+	_ = fake.SetTabTitle(logsID, "logs")
+	_ = fake.SetSessionKeyboardInputEnabled(logsID, false)
+	configuration := readTestConfig(t, applyTestConfig)
+
+	if err := ApplyProfile(configuration, "work", nil, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.Sessions()) != 3 {
+		t.Fatalf("no session should be created, got\n%s", fake)
+	}
+	editor, _ := fake.Session(editorID)
+	if editor.Title != "editor" || editor.Closable || editor.MonitorSilence {
+		t.Errorf("editor session not updated: %+v", editor)
+	}
+	logs, _ := fake.Session(logsID)
+	if !logs.MonitorActivity || !logs.KeyboardInputEnabled {
+		t.Errorf("logs session not updated: %+v", logs)
+	}
+}
+
+func TestApplyProfilePrune(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	protectedID, _ := fake.AddSession()
+	_ = fake.SetSessionClosable(protectedID, false)
+	configuration := readTestConfig(t, applyTestConfig)
+
+	if err := ApplyProfile(configuration, "work", nil, true, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var titles []string
+	for _, session := range fake.Sessions() {
+		titles = append(titles, session.Title)
+	}
+	if !reflect.DeepEqual(titles, []string{"Shell No. 2", "editor", "logs"}) {
+		t.Errorf("only protected and managed sessions should be left, got\n%s", fake)
+	}
+
+	if err := ApplyProfile(configuration, "work", nil, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if sessions := fake.Sessions(); len(sessions) != 2 {
+		t.Errorf("forced pruning should close protected sessions, got\n%s", fake)
+	}
+}
+
+func TestPlanProfile(t *testing.T) {
+	fake := newFakeYakuake(t)
+	editorID, _ := fake.AddSession()
+	_ = fake.SetTabTitle(editorID, "editor")
+	_ = fake.SetSessionClosable(editorID, false)
+	profile := &ProfileDescription{Name: "work", Tabs: []TabDescription{{Name: "editor"}, {Name: "new"}}}
+
+	plan, err := PlanProfile(profile, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []PlanAction{
+		{Action: ActionUpdate, SessionID: editorID, Title: "editor", Protected: true,
+			Changes: []FlagChange{{Flag: "protected", From: true, To: false}}, Tab: &profile.Tabs[0]},
+		{Action: ActionCreate, SessionID: -1, Title: "new", Tab: &profile.Tabs[1]},
+		{Action: ActionClose, SessionID: 0, Title: "Shell No. 1"},
+	}
+	if !reflect.DeepEqual(plan.Actions, expected) {
+		t.Errorf("unexpected plan\n%+v\nexpected\n%+v", plan.Actions, expected)
+	}
+}
@@ -0,0 +1,414 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// available backends to talk to yakuake
+const (
+	BackendDbus  = "dbus"
+	BackendQdbus = "qdbus"
+)
+
+// the yakuake instance all commands of this tool are working on, set up by initApplication
+var yakuake Yakuake
+
+// Yakuake describes all operations this tool performs on a running yakuake instance.
+// Implementations have to be safe for concurrent use, the status is read with concurrent calls.
+type Yakuake interface {
+	// Ping checks if the yakuake service is reachable
+	Ping() error
+	// Close releases the resources of the backend
+	Close() error
+	// Simulated is true if the operations are only recorded instead of changing yakuake, like in a dry run
+	Simulated() bool
+
+	// sessions
+	AddSession() (int, error)
+	AddSessionTwoHorizontal() (int, error)
+	AddSessionTwoVertical() (int, error)
+	AddSessionQuad() (int, error)
+	ActiveSessionID() (int, error)
+	SessionIDs() ([]int, error)
+	IsSessionClosable(sessionID int) (bool, error)
+	SetSessionClosable(sessionID int, closable bool) error
+	SetSessionMonitorSilenceEnabled(sessionID int, enabled bool) error
+	SetSessionMonitorActivityEnabled(sessionID int, enabled bool) error
+	SetSessionKeyboardInputEnabled(sessionID int, enabled bool) error
+	IsSessionMonitorSilenceEnabled(sessionID int) (bool, error)
+	IsSessionMonitorActivityEnabled(sessionID int) (bool, error)
+	IsSessionKeyboardInputEnabled(sessionID int) (bool, error)
+
+	// terminals
+	TerminalIDs() ([]int, error)
+	// ActiveTerminalID returns the terminal having the focus in the active session
+	ActiveTerminalID() (int, error)
+	TerminalIDsForSessionID(sessionID int) ([]int, error)
+	SessionIDForTerminalID(terminalID int) (int, error)
+	RunCommandInTerminal(terminalID int, command string) error
+	RemoveTerminal(terminalID int) error
+	SetTerminalKeyboardInputEnabled(terminalID int, enabled bool) error
+	IsTerminalKeyboardInputEnabled(terminalID int) (bool, error)
+	// SplitTerminalLeftRight splits a terminal into two side by side and returns the id of the new, right terminal
+	SplitTerminalLeftRight(terminalID int) (int, error)
+	// SplitTerminalTopBottom splits a terminal into two on top of each other and returns the id of the new, bottom terminal
+	SplitTerminalTopBottom(terminalID int) (int, error)
+	// TerminalWorkingDirectory returns the current working directory of the shell of a terminal
+	TerminalWorkingDirectory(terminalID int) (string, error)
+	// TerminalShellPID returns the process id of the shell of a terminal, 0 if it is not started yet
+	TerminalShellPID(terminalID int) (int, error)
+	// TerminalForegroundProcess returns the id and name of the process in the foreground of a terminal
+	TerminalForegroundProcess(terminalID int) (int, string, error)
+	// TerminalText returns the text currently displayed in a terminal
+	TerminalText(terminalID int) (string, error)
+	// SendTextToTerminal types text into a terminal as it is, without executing it
+	SendTextToTerminal(terminalID int, text string) error
+
+	// tabs
+	TabTitle(sessionID int) (string, error)
+	SetTabTitle(sessionID int, title string) error
+	// SessionAtTab returns the id of the session shown at a tab position, starting at 0, -1 if there is no such tab
+	SessionAtTab(index int) (int, error)
+
+	// window
+	ToggleWindowState() error
+	IsWindowVisible() (bool, error)
+}
+
+// NewYakuake creates a yakuake client using the given backend
+func NewYakuake(backend string) (Yakuake, error) {
+	switch strings.ToLower(backend) {
+	case "", BackendDbus:
+		bus, err := newNativeBus()
+		if err != nil {
+			return nil, err
+		}
+		return &yakuakeClient{bus: bus}, nil
+	case BackendQdbus:
+		bus, err := newQdbusBus()
+		if err != nil {
+			return nil, err
+		}
+		return &yakuakeClient{bus: bus}, nil
+	default:
+		return nil, fmt.Errorf("unknown backend '%s', valid backends: %s, %s", backend, BackendDbus, BackendQdbus)
+	}
+}
+
+// bus is the transport a yakuakeClient uses to reach the yakuake service.
+// ret is a pointer to an int32, bool or string receiving the reply, or nil if the reply is not of interest.
+type bus interface {
+	HasService() (bool, error)
+	Call(path string, method string, ret interface{}, args ...interface{}) error
+	Property(path string, name string, ret interface{}) error
+	Close() error
+}
+
+// yakuakeClient implements Yakuake on top of a bus transport
+type yakuakeClient struct {
+	bus bus
+}
+
+func (y *yakuakeClient) Ping() error {
+	hasService, err := y.bus.HasService()
+	if err != nil {
+		return err
+	}
+	if !hasService {
+		return fmt.Errorf("service '%s' is not available on the session bus - probably yakuake is not running", DbusService)
+	}
+	return y.bus.Call(DbusPathSessions, DbusMethodPing, nil)
+}
+
+func (y *yakuakeClient) Close() error {
+	return y.bus.Close()
+}
+
+func (y *yakuakeClient) Simulated() bool {
+	return false
+}
+
+func (y *yakuakeClient) AddSession() (int, error) {
+	return y.callInt(DbusPathSessions, DbusMethodAddSession)
+}
+
+func (y *yakuakeClient) AddSessionTwoHorizontal() (int, error) {
+	return y.callInt(DbusPathSessions, DbusMethodAddSessionLr)
+}
+
+func (y *yakuakeClient) AddSessionTwoVertical() (int, error) {
+	return y.callInt(DbusPathSessions, DbusMethodAddSessionTb)
+}
+
+func (y *yakuakeClient) AddSessionQuad() (int, error) {
+	return y.callInt(DbusPathSessions, DbusMethodAddSessionQu)
+}
+
+func (y *yakuakeClient) ActiveSessionID() (int, error) {
+	return y.callInt(DbusPathSessions, DbusMethodActiveSessionId)
+}
+
+func (y *yakuakeClient) SessionIDs() ([]int, error) {
+	return y.callIDList(DbusPathSessions, DbusMethodSessionIDList)
+}
+
+func (y *yakuakeClient) IsSessionClosable(sessionID int) (bool, error) {
+	return y.callBool(DbusPathSessions, DbusMethodIsSessionClosable, int32(sessionID))
+}
+
+func (y *yakuakeClient) SetSessionClosable(sessionID int, closable bool) error {
+	return y.bus.Call(DbusPathSessions, DbusMethodSetSessionClosable, nil, int32(sessionID), closable)
+}
+
+func (y *yakuakeClient) SetSessionMonitorSilenceEnabled(sessionID int, enabled bool) error {
+	return y.bus.Call(DbusPathSessions, DbusMethodSetSessionMonitorSilence, nil, int32(sessionID), enabled)
+}
+
+func (y *yakuakeClient) SetSessionMonitorActivityEnabled(sessionID int, enabled bool) error {
+	return y.bus.Call(DbusPathSessions, DbusMethodSetSessionMonitorActivity, nil, int32(sessionID), enabled)
+}
+
+func (y *yakuakeClient) SetSessionKeyboardInputEnabled(sessionID int, enabled bool) error {
+	return y.bus.Call(DbusPathSessions, DbusMethodSetKeyboardInputEnabled, nil, int32(sessionID), enabled)
+}
+
+func (y *yakuakeClient) IsSessionMonitorSilenceEnabled(sessionID int) (bool, error) {
+	return y.callBool(DbusPathSessions, DbusMethodIsSessionMonitorSilence, int32(sessionID))
+}
+
+func (y *yakuakeClient) IsSessionMonitorActivityEnabled(sessionID int) (bool, error) {
+	return y.callBool(DbusPathSessions, DbusMethodIsSessionMonitorActivity, int32(sessionID))
+}
+
+func (y *yakuakeClient) IsSessionKeyboardInputEnabled(sessionID int) (bool, error) {
+	return y.callBool(DbusPathSessions, DbusMethodIsKeyboardInputEnabled, int32(sessionID))
+}
+
+func (y *yakuakeClient) ActiveTerminalID() (int, error) {
+	return y.callInt(DbusPathSessions, DbusMethodActiveTerminalId)
+}
+
+func (y *yakuakeClient) TerminalIDs() ([]int, error) {
+	return y.callIDList(DbusPathSessions, DbusMethodTerminalIDList)
+}
+
+func (y *yakuakeClient) TerminalIDsForSessionID(sessionID int) ([]int, error) {
+	return y.callIDList(DbusPathSessions, DbusMethodTerminalIDListForSessionID, int32(sessionID))
+}
+
+func (y *yakuakeClient) SessionIDForTerminalID(terminalID int) (int, error) {
+	return y.callInt(DbusPathSessions, DbusMethodSessionIDForTerminalID, int32(terminalID))
+}
+
+func (y *yakuakeClient) RunCommandInTerminal(terminalID int, command string) error {
+	return y.bus.Call(DbusPathSessions, DbusMethodRunCommandInTerminal, nil, int32(terminalID), command)
+}
+
+func (y *yakuakeClient) RemoveTerminal(terminalID int) error {
+	return y.bus.Call(DbusPathSessions, DbusMethodTerminalRemoval, nil, int32(terminalID))
+}
+
+func (y *yakuakeClient) SetTerminalKeyboardInputEnabled(terminalID int, enabled bool) error {
+	return y.bus.Call(DbusPathSessions, DbusMethodSetTerminalKeyboardInput, nil, int32(terminalID), enabled)
+}
+
+func (y *yakuakeClient) IsTerminalKeyboardInputEnabled(terminalID int) (bool, error) {
+	return y.callBool(DbusPathSessions, DbusMethodIsTerminalKeyboardInput, int32(terminalID))
+}
+
+func (y *yakuakeClient) SplitTerminalLeftRight(terminalID int) (int, error) {
+	return y.callInt(DbusPathSessions, DbusMethodSplitTerminalLeftRight, int32(terminalID))
+}
+
+func (y *yakuakeClient) SplitTerminalTopBottom(terminalID int) (int, error) {
+	return y.callInt(DbusPathSessions, DbusMethodSplitTerminalTopBottom, int32(terminalID))
+}
+
+// the working directory is read from /proc using the shell's pid konsole reports
+func (y *yakuakeClient) TerminalWorkingDirectory(terminalID int) (string, error) {
+	pid, err := y.TerminalShellPID(terminalID)
+	if err != nil {
+		return "", err
+	}
+	if pid <= 0 {
+		return "", fmt.Errorf("no shell process known for terminal #%d", terminalID)
+	}
+	return os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid))
+}
+
+func (y *yakuakeClient) TerminalShellPID(terminalID int) (int, error) {
+	path, err := y.konsoleSessionPath(terminalID)
+	if err != nil {
+		return 0, err
+	}
+	return y.callInt(path, DbusMethodKonsoleProcessID)
+}
+
+// the name of the foreground process is read from /proc, it is empty if the process is not readable
+func (y *yakuakeClient) TerminalForegroundProcess(terminalID int) (int, string, error) {
+	path, err := y.konsoleSessionPath(terminalID)
+	if err != nil {
+		return 0, "", err
+	}
+	pid, err := y.callInt(path, DbusMethodKonsoleForegroundProcessID)
+	if err != nil || pid <= 0 {
+		return 0, "", err
+	}
+	name, _ := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	return pid, strings.TrimSpace(string(name)), nil
+}
+
+func (y *yakuakeClient) TerminalText(terminalID int) (string, error) {
+	path, err := y.konsoleSessionPath(terminalID)
+	if err != nil {
+		return "", err
+	}
+	var text string
+	err = y.bus.Call(path, DbusMethodKonsoleDisplayedText, &text, true)
+	return text, err
+}
+
+func (y *yakuakeClient) SendTextToTerminal(terminalID int, text string) error {
+	path, err := y.konsoleSessionPath(terminalID)
+	if err != nil {
+		return err
+	}
+	return y.bus.Call(path, DbusMethodKonsoleSendText, nil, text)
+}
+
+func (y *yakuakeClient) TabTitle(sessionID int) (string, error) {
+	var title string
+	err := y.bus.Call(DbusPathTabs, DbusMethodTabTitle, &title, int32(sessionID))
+	return title, err
+}
+
+func (y *yakuakeClient) SetTabTitle(sessionID int, title string) error {
+	return y.bus.Call(DbusPathTabs, DbusMethodSetTabTitle, nil, int32(sessionID), title)
+}
+
+func (y *yakuakeClient) SessionAtTab(index int) (int, error) {
+	return y.callInt(DbusPathTabs, DbusMethodSessionAtTab, int32(index))
+}
+
+func (y *yakuakeClient) ToggleWindowState() error {
+	return y.bus.Call(DbusPathWindow, DbusMethodToggleState, nil)
+}
+
+func (y *yakuakeClient) IsWindowVisible() (bool, error) {
+	var visible bool
+	err := y.bus.Property(DbusPathMainwindow, DbusMethodQwidgetVisible, &visible)
+	return visible, err
+}
+
+// call a method returning a single integer
+func (y *yakuakeClient) callInt(path string, method string, args ...interface{}) (int, error) {
+	var value int32
+	err := y.bus.Call(path, method, &value, args...)
+	return int(value), err
+}
+
+// call a method returning a single boolean
+func (y *yakuakeClient) callBool(path string, method string, args ...interface{}) (bool, error) {
+	var value bool
+	err := y.bus.Call(path, method, &value, args...)
+	return value, err
+}
+
+// call a method returning a comma separated list of ids, e.g. terminalIdList
+func (y *yakuakeClient) callIDList(path string, method string, args ...interface{}) ([]int, error) {
+	var output string
+	err := y.bus.Call(path, method, &output, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseIDList(output)
+}
+
+// the konsole session of a terminal. yakuake opens a konsole session for each terminal and both are numbered in the
+// order they are created, so the n-th open terminal belongs to the n-th open konsole session. The numbers differ
+// if konsole sessions were created otherwise, then the session of a terminal is unknown.
+func (y *yakuakeClient) konsoleSessionPath(terminalID int) (string, error) {
+	terminalIDs, err := y.TerminalIDs()
+	if err != nil {
+		return "", err
+	}
+	var introspection string
+	if err := y.bus.Call(DbusPathKonsoleSessions, DbusMethodIntrospect, &introspection); err != nil {
+		return "", err
+	}
+	sessionIDs := konsoleSessionIDs(introspection)
+	if len(sessionIDs) != len(terminalIDs) {
+		return "", fmt.Errorf("the konsole session of terminal #%d is unknown, there are %d terminals, but %d konsole sessions",
+			terminalID, len(terminalIDs), len(sessionIDs))
+	}
+	sort.Ints(terminalIDs)
+	index := sort.SearchInts(terminalIDs, terminalID)
+	if index >= len(terminalIDs) || terminalIDs[index] != terminalID {
+		return "", fmt.Errorf("no terminal #%d", terminalID)
+	}
+	return fmt.Sprintf("%s/%d", DbusPathKonsoleSessions, sessionIDs[index]), nil
+}
+
+// child nodes of an introspection of the konsole sessions, e.g. <node name="3"/>
+var introspectedNode = regexp.MustCompile(`<node name="(\d+)"`)
+
+// the sorted ids of the konsole sessions listed by an introspection
+func konsoleSessionIDs(introspection string) []int {
+	var ids []int
+	for _, match := range introspectedNode.FindAllStringSubmatch(introspection, -1) {
+		id, _ := strconv.Atoi(match[1])
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// parse a comma separated list of ids as returned by yakuake
+func parseIDList(input string) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id '%s' in list '%s'", part, input)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// join ids to a list separated by comma, the format parseIDList reads
+func joinIDs(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,76 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/godbus/dbus/v5"
+)
+
+// nativeBus talks to the yakuake service through a private connection to the D-Bus session bus
+type nativeBus struct {
+	conn *dbus.Conn
+}
+
+func newNativeBus() (*nativeBus, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the D-Bus session bus: %v", err)
+	}
+	return &nativeBus{conn: conn}, nil
+}
+
+func (n *nativeBus) HasService() (bool, error) {
+	var hasOwner bool
+	err := n.conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, DbusService).Store(&hasOwner)
+	if err != nil {
+		return false, err
+	}
+	return hasOwner, nil
+}
+
+func (n *nativeBus) Call(path string, method string, ret interface{}, args ...interface{}) error {
+	call := n.conn.Object(DbusService, dbus.ObjectPath(path)).Call(method, 0, args...)
+	if call.Err != nil {
+		return fmt.Errorf("%s %s: %v", path, method, call.Err)
+	}
+	if ret == nil {
+		return nil
+	}
+	if err := call.Store(ret); err != nil {
+		return fmt.Errorf("%s %s: invalid reply: %v", path, method, err)
+	}
+	return nil
+}
+
+func (n *nativeBus) Property(path string, name string, ret interface{}) error {
+	variant, err := n.conn.Object(DbusService, dbus.ObjectPath(path)).GetProperty(name)
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", path, name, err)
+	}
+	if err := dbus.Store([]interface{}{variant.Value()}, ret); err != nil {
+		return fmt.Errorf("%s %s: invalid value: %v", path, name, err)
+	}
+	return nil
+}
+
+func (n *nativeBus) Close() error {
+	return n.conn.Close()
+}
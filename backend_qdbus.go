@@ -0,0 +1,104 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// names of the qdbus binary on different distributions, in order of preference
+var qdbusApps = []string{"qdbus", "qdbus6", "qdbus-qt6", "qdbus-qt5"}
+
+// qdbusBus talks to the yakuake service by executing the qdbus command line tool, one process per call
+type qdbusBus struct {
+	app string
+}
+
+func newQdbusBus() (*qdbusBus, error) {
+	for _, app := range qdbusApps {
+		if path, err := exec.LookPath(app); err == nil {
+			return &qdbusBus{app: path}, nil
+		}
+	}
+	return nil, fmt.Errorf("qdbus command is missing - probably it is not installed. Tried: %s", strings.Join(qdbusApps, ", "))
+}
+
+func (q *qdbusBus) HasService() (bool, error) {
+	output, err := exec.Command(q.app).Output()
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(line) == DbusService {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (q *qdbusBus) Call(path string, method string, ret interface{}, args ...interface{}) error {
+	arguments := []string{DbusService, path, method}
+	for _, arg := range args {
+		arguments = append(arguments, fmt.Sprint(arg))
+	}
+	out, err := exec.Command(q.app, arguments...).Output()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", path, method, err)
+	}
+	if ret == nil {
+		return nil
+	}
+	return parseQdbusOutput(strings.Trim(string(out), "\n"), ret)
+}
+
+// qdbus does not distinguish between properties and methods
+func (q *qdbusBus) Property(path string, name string, ret interface{}) error {
+	return q.Call(path, name, ret)
+}
+
+func (q *qdbusBus) Close() error {
+	return nil
+}
+
+// convert the textual output of qdbus to the type of ret
+func parseQdbusOutput(output string, ret interface{}) error {
+	switch value := ret.(type) {
+	case *string:
+		*value = output
+	case *bool:
+		parsed, err := strconv.ParseBool(output)
+		if err != nil {
+			return fmt.Errorf("invalid boolean output '%s' of qdbus", output)
+		}
+		*value = parsed
+	case *int32:
+		parsed, err := strconv.ParseInt(output, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid integer output '%s' of qdbus", output)
+		}
+		*value = int32(parsed)
+	default:
+		return fmt.Errorf("unsupported reply type %T", ret)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CloseSelection names the tabs and terminals to close
+type CloseSelection struct {
+	// session ids or patterns of tab titles
+	Targets   []string
+	Terminals []int
+	// profiles whose tabs are closed, matched by title like 'profile apply' does
+	Profiles  []string
+	Variables map[string]string
+}
+
+// CloseSessions closes the selected tabs and terminals, protected tabs only with force.
+// The terminals of the active session are closed last, so the shell yakctl runs in is not killed first.
+func CloseSessions(configuration *YakCtlConfiguration, selection CloseSelection, force bool) error {
+	terminalIDs, err := selectTerminalsToClose(configuration, selection)
+	if err != nil {
+		return err
+	}
+	if clearSessions(force, terminalIDs, nil) {
+		color.Success.Println("Selected sessions closed!")
+	}
+	return nil
+}
+
+// resolve the selection to terminal ids, a target matching nothing is an error
+func selectTerminalsToClose(configuration *YakCtlConfiguration, selection CloseSelection) ([]int, error) {
+	if len(selection.Targets) == 0 && len(selection.Terminals) == 0 && len(selection.Profiles) == 0 {
+		return nil, fmt.Errorf("nothing to close, name sessions, tab titles, terminals or profiles")
+	}
+	states, err := readSessionStates()
+	if err != nil {
+		return nil, err
+	}
+	var terminalIDs []int
+	selected := map[int]bool{}
+	add := func(ids ...int) {
+		for _, id := range ids {
+			if !selected[id] {
+				selected[id] = true
+				terminalIDs = append(terminalIDs, id)
+			}
+		}
+	}
+
+	for _, target := range selection.Targets {
+		matches, err := sessionsMatching(states, target)
+		if err != nil {
+			return nil, err
+		}
+		for _, state := range matches {
+			add(state.Terminals...)
+		}
+	}
+	for _, terminalID := range selection.Terminals {
+		if !terminalExists(states, terminalID) {
+			return nil, fmt.Errorf("no terminal #%d", terminalID)
+		}
+		add(terminalID)
+	}
+	for _, profileName := range selection.Profiles {
+		tabs, err := openTabsOfProfile(configuration, profileName, selection.Variables, states)
+		if err != nil {
+			return nil, err
+		}
+		for _, tab := range tabs {
+			add(tab.state.Terminals...)
+		}
+	}
+	return terminalIDs, nil
+}
+
+// the sessions selected by an id or a pattern of their tab title
+func sessionsMatching(states []sessionState, target string) ([]sessionState, error) {
+	if sessionID, err := strconv.Atoi(target); err == nil {
+		state, err := sessionByID(states, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		return []sessionState{state}, nil
+	}
+	return sessionsWithTitle(states, target)
+}
+
+func sessionByID(states []sessionState, sessionID int) (sessionState, error) {
+	for _, state := range states {
+		if state.ID == sessionID {
+			return state, nil
+		}
+	}
+	return sessionState{}, fmt.Errorf("no session #%d", sessionID)
+}
+
+// the sessions whose tab title matches a pattern, at least one
+func sessionsWithTitle(states []sessionState, pattern string) ([]sessionState, error) {
+	expression, err := titlePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var matches []sessionState
+	for _, state := range states {
+		if expression.MatchString(state.Title) {
+			matches = append(matches, state)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no tab title matches '%s'", pattern)
+	}
+	return matches, nil
+}
+
+func terminalExists(states []sessionState, terminalID int) bool {
+	for _, state := range states {
+		for _, id := range state.Terminals {
+			if id == terminalID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// titlePattern compiles a pattern of tab titles: a regular expression between slashes like /^build-\d+$/,
+// otherwise a glob matching the whole title, in which * stands for any text and ? for a single character
+func titlePattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expression, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%s': %v", pattern, err)
+		}
+		return expression, nil
+	}
+	glob := regexp.QuoteMeta(pattern)
+	glob = strings.ReplaceAll(glob, `\*`, ".*")
+	glob = strings.ReplaceAll(glob, `\?`, ".")
+	return regexp.MustCompile("^" + glob + "$"), nil
+}
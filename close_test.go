@@ -0,0 +1,205 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/emschu/yakctl/internal/fakeyakuake"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// open a session with two terminals for each title
+func openTitledSessions(t *testing.T, fake *fakeyakuake.Yakuake, titles ...string) map[string]int {
+	t.Helper()
+	sessions := map[string]int{}
+	for _, title := range titles {
+		sessionID, err := fake.AddSessionTwoHorizontal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = fake.SetTabTitle(sessionID, title)
+		sessions[title] = sessionID
+	}
+	return sessions
+}
+
+func sessionTitles(fake *fakeyakuake.Yakuake) []string {
+	var titles []string
+	for _, session := range fake.Sessions() {
+		titles = append(titles, session.Title)
+	}
+	return titles
+}
+
+func TestCloseSessions(t *testing.T) {
+	fake := newFakeYakuake(t)
+	output := captureOutput(t)
+	sessions := openTitledSessions(t, fake, "build-1", "build-2", "logs", "editor", "docs")
+	_ = fake.SetSessionClosable(sessions["logs"], false)
+
+	if err := CloseSessions(nil, CloseSelection{Targets: []string{"build-*"}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if titles := sessionTitles(fake); !reflect.DeepEqual(titles, []string{"Shell No. 1", "logs", "editor", "docs"}) {
+		t.Fatalf("the build tabs should be closed, got %v", titles)
+	}
+
+	if err := CloseSessions(nil, CloseSelection{Targets: []string{"/^lo.s$/"}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, open := fake.Session(sessions["logs"]); !open {
+		t.Errorf("protected tabs must not be closed without force")
+	}
+	if !strings.Contains(output.String(), "is protected and not closable") {
+		t.Errorf("missing warning about the protected tab:\n%s", output)
+	}
+	if err := CloseSessions(nil, CloseSelection{Targets: []string{"/^lo.s$/"}}, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, open := fake.Session(sessions["logs"]); open {
+		t.Errorf("protected tabs should be closed with force")
+	}
+
+	editor, _ := fake.Session(sessions["editor"])
+	selection := CloseSelection{Targets: []string{strconv.Itoa(sessions["docs"])}, Terminals: []int{editor.Terminals[1]}}
+	if err := CloseSessions(nil, selection, false); err != nil {
+		t.Fatal(err)
+	}
+	if titles := sessionTitles(fake); !reflect.DeepEqual(titles, []string{"Shell No. 1", "editor"}) {
+		t.Fatalf("the docs tab should be closed, got %v", titles)
+	}
+	if editor, _ = fake.Session(sessions["editor"]); len(editor.Terminals) != 1 {
+		t.Errorf("only one terminal of the editor tab should be closed, got %v", editor.Terminals)
+	}
+}
+
+func TestCloseSessionsOfProfile(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	openTitledSessions(t, fake, "Editor", "logs", "other")
+	configuration := readTestConfig(t, applyTestConfig)
+
+	if err := CloseSessions(configuration, CloseSelection{Profiles: []string{"work"}}, true); err != nil {
+		t.Fatal(err)
+	}
+	if titles := sessionTitles(fake); !reflect.DeepEqual(titles, []string{"Shell No. 1", "other"}) {
+		t.Errorf("the tabs of the profile should be closed, got %v", titles)
+	}
+	if err := CloseSessions(configuration, CloseSelection{Profiles: []string{"work"}}, true); err == nil {
+		t.Errorf("expected an error if no tab of the profile is open")
+	}
+	selection := CloseSelection{Profiles: []string{"work"}, Variables: map[string]string{"typo": "x"}}
+	if err := CloseSessions(configuration, selection, true); err == nil || !strings.Contains(err.Error(), "'typo' is not declared") {
+		t.Errorf("expected an error about the undeclared variable, got %v", err)
+	}
+}
+
+func TestCloseSessionsNothingMatches(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	openTitledSessions(t, fake, "logs")
+
+	for _, selection := range []CloseSelection{
+		{},
+		{Targets: []string{"42"}},
+		{Targets: []string{"build-*"}},
+		{Targets: []string{"logs", "/[/"}},
+		{Terminals: []int{42}},
+	} {
+		if err := CloseSessions(nil, selection, false); err == nil {
+			t.Errorf("expected an error for %+v", selection)
+		}
+	}
+	if len(fake.Sessions()) != 2 {
+		t.Errorf("nothing should be closed if a target is invalid, got\n%s", fake)
+	}
+}
+
+func TestTitlePattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		title   string
+		matches bool
+	}{
+		{"logs", "logs", true},
+		{"logs", "logs 2", false},
+		{"build-*", "build-12", true},
+		{"build-?", "build-12", false},
+		{"*.go", "main.go", true},
+		{"*.go", "main_go", false},
+		{"~/src/*", "~/src/yakctl", true},
+		{"/^build-\\d+$/", "build-12", true},
+		{"/build/", "nightly build", true},
+		{"/^build$/", "nightly build", false},
+	} {
+		pattern, err := titlePattern(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if matches := pattern.MatchString(test.title); matches != test.matches {
+			t.Errorf("pattern '%s' on '%s': expected %v, got %v", test.pattern, test.title, test.matches, matches)
+		}
+	}
+}
+
+func TestCloseTerminalOfProtectedTab(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	sessions := openTitledSessions(t, fake, "logs")
+	_ = fake.SetSessionClosable(sessions["logs"], false)
+	logs, _ := fake.Session(sessions["logs"])
+
+	if err := CloseSessions(nil, CloseSelection{Terminals: []int{logs.Terminals[1]}}, true); err != nil {
+		t.Fatal(err)
+	}
+	logs, open := fake.Session(sessions["logs"])
+	if !open || len(logs.Terminals) != 1 {
+		t.Fatalf("only one terminal of the tab should be closed, got\n%s", fake)
+	}
+	if logs.Closable {
+		t.Errorf("the tab should still be protected after closing one of its terminals")
+	}
+}
+
+func TestDryRunCloseProtectedTab(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	sessions := openTitledSessions(t, fake, "logs", "build")
+	_ = fake.SetSessionClosable(sessions["logs"], false)
+	_ = fake.SetSessionClosable(sessions["build"], false)
+	build, _ := fake.Session(sessions["build"])
+	recorder := newDryRunYakuake(fake)
+	yakuake = recorder
+
+	// the plan closes all terminals of logs and one terminal of build, which stays open
+	if err := CloseSessions(nil, CloseSelection{Targets: []string{"logs"}, Terminals: []int{build.Terminals[1]}}, true); err != nil {
+		t.Fatal(err)
+	}
+	operations := strings.Join(recorder.Operations(), "\n")
+	if strings.Contains(operations, fmt.Sprintf("setSessionClosable(%d, false)", sessions["logs"])) {
+		t.Errorf("a closed tab must not be protected again:\n%s", operations)
+	}
+	if !strings.Contains(operations, fmt.Sprintf("setSessionClosable(%d, false)", sessions["build"])) {
+		t.Errorf("the partly closed tab should be protected again:\n%s", operations)
+	}
+}
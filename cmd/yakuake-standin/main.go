@@ -0,0 +1,89 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// yakuake-standin registers a simulated yakuake on the D-Bus session bus.
+// It allows running yakctl end-to-end without a KDE desktop, e.g. in a headless container:
+//
+//	dbus-run-session -- sh -c 'yakuake-standin & sleep 1; yakctl profile open 1'
+package main
+
+import (
+	"fmt"
+	"github.com/emschu/yakctl/internal/fakeyakuake"
+	"github.com/godbus/dbus/v5"
+	"github.com/gookit/color"
+	"github.com/urfave/cli/v2"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	var sessions int
+	var visible bool
+
+	app := &cli.App{
+		Name:  "yakuake-standin",
+		Usage: "Provide a simulated yakuake instance on the D-Bus session bus",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:        "sessions",
+				Usage:       "number of sessions open at start",
+				Value:       1,
+				Destination: &sessions,
+			},
+			&cli.BoolFlag{
+				Name:        "visible",
+				Usage:       "show the window at start",
+				Value:       false,
+				Destination: &visible,
+			},
+		},
+		Action: func(context *cli.Context) error {
+			conn, err := dbus.ConnectSessionBus()
+			if err != nil {
+				return fmt.Errorf("unable to connect to the D-Bus session bus: %v", err)
+			}
+			defer conn.Close()
+
+			instance := fakeyakuake.New()
+			for i := 0; i < sessions; i++ {
+				if _, err := instance.AddSession(); err != nil {
+					return err
+				}
+			}
+			instance.SetWindowVisible(visible)
+			if err := instance.Serve(conn); err != nil {
+				return err
+			}
+			color.Info.Printf("Serving '%s' with %d session(s)\n", fakeyakuake.ServiceName, sessions)
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+			<-signals
+			color.Info.Printf("Final state:\n%s\n", instance)
+			return nil
+		},
+	}
+	err := app.Run(os.Args)
+	if err != nil {
+		color.Errorf("%v\n", err)
+		os.Exit(1)
+	}
+}
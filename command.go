@@ -0,0 +1,254 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gookit/color"
+	"gopkg.in/yaml.v3"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// how long to wait for the shell of a new terminal and for the process a command waits for, 0 disables waiting
+var shellTimeout = 10 * time.Second
+
+// how often the processes of a terminal are queried while waiting
+var shellPollInterval = 100 * time.Millisecond
+
+// errProcessesUnknown is returned if the backend can't tell the processes of a terminal, e.g. for older konsole versions
+var errProcessesUnknown = errors.New("the processes of the terminal are unknown")
+
+// Command is a command run in a terminal, written as text or as mapping with options
+type Command struct {
+	Run string `yaml:"run,omitempty"`
+	// text typed into the terminal as it is instead of a command, e.g. an answer to a prompt
+	SendKeys string `yaml:"sendKeys,omitempty"`
+	// shell command evaluated locally before, the command is skipped if it fails
+	If string `yaml:"if,omitempty"`
+	// name of the process which has to be in the foreground of the terminal before the command is run, e.g. ssh
+	WaitFor string `yaml:"waitFor,omitempty"`
+	// duration to wait before the command is run, e.g. 500ms or 2s
+	Delay string `yaml:"delay,omitempty"`
+	// text which has to appear in the terminal after the command, before the next one is run
+	Expect string `yaml:"expect,omitempty"`
+	// how often the command is repeated if the expected text does not appear
+	Retry int `yaml:"retry,omitempty"`
+}
+
+// MarshalYAML writes commands without options as text
+func (c Command) MarshalYAML() (interface{}, error) {
+	if c == (Command{Run: c.Run}) {
+		return c.Run, nil
+	}
+	type plainCommand Command
+	return plainCommand(c), nil
+}
+
+// UnmarshalYAML reads a command given as text or as mapping
+func (c *Command) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*c = Command{Run: node.Value}
+		return nil
+	}
+	type plainCommand Command
+	return node.Decode((*plainCommand)(c))
+}
+
+// run commands in a terminal one after another, checking their condition and waiting for their process and delay first.
+// If the process a command waits for or the text it expects does not show up, the remaining commands are not run.
+func runCommands(commands []Command, terminalID int) {
+	for i, command := range commands {
+		if len(command.If) > 0 && !conditionHolds(command.If) {
+			color.Info.Printf("Skip '%s' in terminal #%d, the condition '%s' is not met\n", command.text(), terminalID, command.If)
+			continue
+		}
+		if len(command.WaitFor) > 0 {
+			err := waitForTerminal(terminalID, foregroundProcessIs(command.WaitFor))
+			if errors.Is(err, errProcessesUnknown) {
+				color.Warn.Printf("Can't wait for '%s' in terminal #%d: %v\n", command.WaitFor, terminalID, err)
+			} else if err != nil {
+				color.Error.Printf("'%s' is not running in terminal #%d: %v, skipping %d command(s)\n", command.WaitFor, terminalID, err, len(commands)-i)
+				return
+			}
+		}
+		if len(command.Delay) > 0 {
+			// the configuration is validated when it is read, but commands may be created otherwise
+			if delay, err := time.ParseDuration(command.Delay); err != nil || delay < 0 {
+				color.Warn.Printf("Invalid delay '%s' in terminal #%d, running the command without delay\n", command.Delay, terminalID)
+			} else {
+				color.Info.Printf("Wait %v before the next command in terminal #%d\n", delay, terminalID)
+				pause(delay)
+			}
+		}
+		if err := runCommand(command, terminalID); err != nil {
+			color.Error.Printf("%v, skipping %d command(s)\n", err, len(commands)-i-1)
+			return
+		}
+	}
+}
+
+// run or type a single command, repeated until the expected text appears
+func runCommand(command Command, terminalID int) error {
+	for attempt := 0; ; attempt++ {
+		// the expected text has to appear once more than before, as the terminal may already show it
+		known := 0
+		if len(command.Expect) > 0 {
+			text, err := yakuake.TerminalText(terminalID)
+			if err != nil {
+				color.Warn.Printf("Can't wait for '%s' in terminal #%d: %v\n", command.Expect, terminalID, err)
+				command.Expect = ""
+			}
+			known = strings.Count(text, command.Expect)
+		}
+		if len(command.SendKeys) > 0 {
+			sendKeysToTerminal(command.SendKeys, terminalID)
+		} else {
+			executeCommandInTerminal(command.Run, terminalID)
+		}
+		if len(command.Expect) == 0 {
+			return nil
+		}
+		err := waitForText(terminalID, command.Expect, command.echo(), known)
+		if err == nil {
+			return nil
+		}
+		if attempt >= command.Retry {
+			return fmt.Errorf("'%s' did not appear in terminal #%d: %v", command.Expect, terminalID, err)
+		}
+		color.Warn.Printf("'%s' did not appear in terminal #%d, repeating '%s'\n", command.Expect, terminalID, command.text())
+	}
+}
+
+// the command or keys typed, for messages
+func (c Command) text() string {
+	if len(c.SendKeys) > 0 {
+		return c.SendKeys
+	}
+	return c.Run
+}
+
+// the line the terminal echoes when the command is typed, the expected text has to appear in the output instead
+func (c Command) echo() string {
+	line, _, _ := strings.Cut(c.text(), "\n")
+	return strings.TrimSpace(line)
+}
+
+// count the occurrences of text, except the ones in the last line echoing the typed command
+func countOutput(displayed string, text string, echo string) int {
+	count := strings.Count(displayed, text)
+	if index := strings.LastIndex(displayed, echo); len(echo) > 0 && index >= 0 {
+		start := strings.LastIndex(displayed[:index], "\n") + 1
+		end := len(displayed)
+		if length := strings.Index(displayed[index:], "\n"); length >= 0 {
+			end = index + length
+		}
+		count -= strings.Count(displayed[start:end], text)
+	}
+	return count
+}
+
+// a condition is a shell command, which holds if it succeeds. A dry run does not run it and assumes it holds.
+func conditionHolds(condition string) bool {
+	if yakuake.Simulated() {
+		color.Cyan.Printf("[dry-run] condition '%s' is not checked, assuming it holds\n", condition)
+		return true
+	}
+	return exec.Command("sh", "-c", condition).Run() == nil
+}
+
+// poll the text of a terminal until its output contains text more than known times, at most for shellTimeout.
+// The line echoing the typed command is not part of the output.
+func waitForText(terminalID int, text string, echo string, known int) error {
+	if shellTimeout <= 0 {
+		return nil
+	}
+	deadline := time.Now().Add(shellTimeout)
+	for {
+		displayed, err := yakuake.TerminalText(terminalID)
+		if err != nil {
+			return err
+		}
+		if countOutput(displayed, text, echo) > known {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("timeout after %v", shellTimeout)
+		}
+		time.Sleep(shellPollInterval)
+	}
+}
+
+// wait until the shells of new terminals are started and ready for input, so no command is typed too early.
+// If a shell is not ready in time or the backend can't tell, the commands are sent anyway.
+func waitForShells(terminalIDs []int) {
+	for _, terminalID := range terminalIDs {
+		err := waitForTerminal(terminalID, shellIsReady)
+		if err != nil && !errors.Is(err, errProcessesUnknown) {
+			color.Warn.Printf("The shell of terminal #%d is not ready: %v, sending the commands anyway\n", terminalID, err)
+		}
+	}
+}
+
+// a shell is ready if it is started and in the foreground of its terminal
+func shellIsReady(shellPID int, foregroundPID int, _ string) bool {
+	return shellPID > 0 && foregroundPID == shellPID
+}
+
+func foregroundProcessIs(name string) func(int, int, string) bool {
+	return func(_ int, _ int, foregroundName string) bool {
+		return foregroundName == name
+	}
+}
+
+// poll the processes of a terminal until ready reports true, at most for shellTimeout
+func waitForTerminal(terminalID int, ready func(shellPID int, foregroundPID int, foregroundName string) bool) error {
+	if shellTimeout <= 0 {
+		return nil
+	}
+	deadline := time.Now().Add(shellTimeout)
+	for {
+		shellPID, err := yakuake.TerminalShellPID(terminalID)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errProcessesUnknown, err)
+		}
+		foregroundPID, foregroundName, err := yakuake.TerminalForegroundProcess(terminalID)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errProcessesUnknown, err)
+		}
+		if ready(shellPID, foregroundPID, foregroundName) {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("timeout after %v", shellTimeout)
+		}
+		time.Sleep(shellPollInterval)
+	}
+}
+
+// wait for the given duration, a dry run does not wait
+func pause(duration time.Duration) {
+	if yakuake.Simulated() {
+		return
+	}
+	time.Sleep(duration)
+}
@@ -0,0 +1,292 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wait at most the given time for shells and processes, polling often
+func setShellTimeout(t *testing.T, timeout time.Duration) {
+	t.Helper()
+	previousTimeout, previousInterval := shellTimeout, shellPollInterval
+	shellTimeout, shellPollInterval = timeout, time.Millisecond
+	t.Cleanup(func() {
+		shellTimeout, shellPollInterval = previousTimeout, previousInterval
+	})
+}
+
+func TestCommandForms(t *testing.T) {
+	var tab TabDescription
+	if err := yaml.Unmarshal([]byte("name: a\ncommands:\n  - ls\n  - run: uptime\n    delay: 2s\n    waitFor: ssh\n"), &tab); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Command{{Run: "ls"}, {Run: "uptime", Delay: "2s", WaitFor: "ssh"}}
+	if !reflect.DeepEqual(tab.Commands, expected) {
+		t.Fatalf("unexpected commands %+v", tab.Commands)
+	}
+
+	marshalled, err := marshalYAML(tab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(marshalled), "commands:\n  - ls\n  - run: uptime\n    waitFor: ssh\n    delay: 2s\n") {
+		t.Errorf("commands without options should be written as text, got\n%s", marshalled)
+	}
+}
+
+func TestLoadSessionWaitsForShell(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	setShellTimeout(t, time.Second)
+	fake.SetShellStartup(3)
+	configuration := readTestConfig(t, `
+profiles:
+  - name: slow
+    tabs:
+      - name: zsh
+        split: lr
+        commands:
+          - ls
+        terminal2:
+          - top
+`)
+
+	if err := LoadSession(configuration, "slow"); err != nil {
+		t.Fatal(err)
+	}
+
+	session := sessionByTitle(t, fake, "zsh")
+	expectedCommands := [][]string{{"ls"}, {"ls", "top"}}
+	for i, terminalID := range session.Terminals {
+		if commands := fake.Commands(terminalID); !reflect.DeepEqual(commands, expectedCommands[i]) {
+			t.Errorf("commands typed before the shell was ready got lost in terminal%d: %v", i+1, commands)
+		}
+	}
+}
+
+func TestLoadSessionShellTimeout(t *testing.T) {
+	fake := newFakeYakuake(t)
+	output := captureOutput(t)
+	setShellTimeout(t, 5*time.Millisecond)
+	fake.SetShellStartup(1000)
+	configuration := readTestConfig(t, "profiles:\n  - name: slow\n    tabs:\n      - name: zsh\n        commands: [ls]\n")
+
+	if err := LoadSession(configuration, "slow"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "is not ready: timeout after 5ms, sending the commands anyway") {
+		t.Errorf("expected a warning about the timeout, got\n%s", output)
+	}
+}
+
+func TestLoadSessionWaitFor(t *testing.T) {
+	fake := newFakeYakuake(t)
+	output := captureOutput(t)
+	setShellTimeout(t, 20*time.Millisecond)
+	fake.KeepRunning("ssh")
+	configuration := readTestConfig(t, `
+profiles:
+  - name: remote
+    tabs:
+      - name: pi
+        commands:
+          - ssh pi@10.10.10.11
+          - run: uptime
+            delay: 1ms
+            waitFor: ssh
+      - name: mosh
+        commands:
+          - mosh pi@10.10.10.11
+          - run: uptime
+            waitFor: mosh-client
+          - htop
+`)
+
+	if err := LoadSession(configuration, "remote"); err != nil {
+		t.Fatal(err)
+	}
+
+	pi := sessionByTitle(t, fake, "pi")
+	if commands := fake.Commands(pi.Terminals[0]); !reflect.DeepEqual(commands, []string{"ssh pi@10.10.10.11", "uptime"}) {
+		t.Errorf("unexpected commands %v", commands)
+	}
+	mosh := sessionByTitle(t, fake, "mosh")
+	if commands := fake.Commands(mosh.Terminals[0]); !reflect.DeepEqual(commands, []string{"mosh pi@10.10.10.11"}) {
+		t.Errorf("commands after a missing process must not be run, got %v", commands)
+	}
+	if !strings.Contains(output.String(), "'mosh-client' is not running in terminal #2: timeout after 20ms, skipping 2 command(s)") {
+		t.Errorf("expected an error about the missing process, got\n%s", output)
+	}
+}
+
+func TestLoadSessionCommandSequence(t *testing.T) {
+	fake := newFakeYakuake(t)
+	output := captureOutput(t)
+	setShellTimeout(t, 20*time.Millisecond)
+	fake.Respond("ssh pi@10.10.10.11", "pi@raspberrypi:~ $ ")
+	fake.Respond("sudo -i", "[sudo] password for pi: ")
+	fake.Respond("secret", "root@raspberrypi:~# ")
+	fake.Respond("ping -c1 router", "0 received", "1 received")
+	configuration := readTestConfig(t, `
+profiles:
+  - name: pi
+    tabs:
+      - name: pi
+        commands:
+          - run: echo skipped
+            if: "false"
+          - run: echo included
+            if: "true"
+          - run: ssh pi@10.10.10.11
+            expect: "$ "
+          - run: sudo -i
+            expect: "password for"
+          - sendKeys: "secret\n"
+            expect: "# "
+          - run: ping -c1 router
+            expect: 1 received
+            retry: 1
+          - tail -f /var/log/syslog
+      - name: failing
+        commands:
+          - run: ping -c1 router
+            expect: 1 received
+          - htop
+`)
+
+	if err := LoadSession(configuration, "pi"); err != nil {
+		t.Fatal(err)
+	}
+
+	pi := sessionByTitle(t, fake, "pi")
+	expectedCommands := []string{"echo included", "ssh pi@10.10.10.11", "sudo -i", "ping -c1 router", "ping -c1 router", "tail -f /var/log/syslog"}
+	if commands := fake.Commands(pi.Terminals[0]); !reflect.DeepEqual(commands, expectedCommands) {
+		t.Errorf("unexpected commands %v", commands)
+	}
+	if sent := fake.SentText(pi.Terminals[0]); !reflect.DeepEqual(sent, []string{"secret\n"}) {
+		t.Errorf("unexpected keys %q", sent)
+	}
+	failing := sessionByTitle(t, fake, "failing")
+	if commands := fake.Commands(failing.Terminals[0]); !reflect.DeepEqual(commands, []string{"ping -c1 router"}) {
+		t.Errorf("commands after a missing text must not be run, got %v", commands)
+	}
+	if !strings.Contains(output.String(), "'1 received' did not appear in terminal #2: timeout after 20ms, skipping 1 command(s)") {
+		t.Errorf("expected an error about the missing text, got\n%s", output)
+	}
+}
+
+func TestExpectIgnoresEchoedCommand(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	setShellTimeout(t, 20*time.Millisecond)
+	fake.Respond("ssh build-host", "connecting...\n", "connecting...\nWelcome to build-host\n")
+	configuration := readTestConfig(t, `
+profiles:
+  - name: build
+    tabs:
+      - name: unreachable
+        commands:
+          - run: ssh build-host
+            expect: build-host
+          - uptime
+      - name: reachable
+        commands:
+          - run: ssh build-host
+            expect: build-host
+          - uptime
+`)
+
+	if err := LoadSession(configuration, "build"); err != nil {
+		t.Fatal(err)
+	}
+	unreachable := sessionByTitle(t, fake, "unreachable")
+	if commands := fake.Commands(unreachable.Terminals[0]); !reflect.DeepEqual(commands, []string{"ssh build-host"}) {
+		t.Errorf("the echoed command must not count as expected output, got %v", commands)
+	}
+	reachable := sessionByTitle(t, fake, "reachable")
+	if commands := fake.Commands(reachable.Terminals[0]); !reflect.DeepEqual(commands, []string{"ssh build-host", "uptime"}) {
+		t.Errorf("unexpected commands %v", commands)
+	}
+}
+
+func TestDryRunDoesNotWait(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	setShellTimeout(t, time.Hour)
+	recorder := newDryRunYakuake(fake)
+	yakuake = recorder
+	configuration := readTestConfig(t, "profiles:\n  - name: slow\n    tabs:\n      - name: zsh\n        commands:\n          - run: ssh pi\n            delay: 1h\n          - run: ls\n            waitFor: ssh\n")
+
+	if err := LoadSession(configuration, "slow"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"addSession() = 1000000",
+		`setTabTitle(1000000, "zsh")`,
+		`runCommandInTerminal(1000001, "ssh pi")`,
+		`runCommandInTerminal(1000001, "ls")`,
+	}
+	if operations := recorder.Operations(); !reflect.DeepEqual(operations[:len(expected)], expected) {
+		t.Errorf("unexpected operations %q", operations)
+	}
+}
+
+func TestDryRunDoesNotCheckConditions(t *testing.T) {
+	fake := newFakeYakuake(t)
+	output := captureOutput(t)
+	recorder := newDryRunYakuake(fake)
+	yakuake = recorder
+	marker := filepath.Join(t.TempDir(), "checked")
+	configuration := readTestConfig(t, "profiles:\n  - name: guarded\n    tabs:\n      - name: a\n        commands:\n          - run: make\n            if: touch "+marker+" && false\n")
+
+	if err := LoadSession(configuration, "guarded"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("a dry run must not run conditions")
+	}
+	if !strings.Contains(output.String(), "condition 'touch "+marker+" && false' is not checked") {
+		t.Errorf("expected a note about the condition, got\n%s", output)
+	}
+	if operations := recorder.Operations(); !strings.Contains(strings.Join(operations, "\n"), `runCommandInTerminal(1000001, "make")`) {
+		t.Errorf("the command should be planned as if the condition holds, got %q", operations)
+	}
+}
+
+func TestRunCommandsInvalidDelay(t *testing.T) {
+	fake := newFakeYakuake(t)
+	output := captureOutput(t)
+
+	// commands created without reading a configuration are not validated
+	runCommands([]Command{{Run: "ls", Delay: "soon"}}, 0)
+	if commands := fake.Commands(0); !reflect.DeepEqual(commands, []string{"ls"}) {
+		t.Errorf("the command should run without delay, got %v", commands)
+	}
+	if !strings.Contains(output.String(), "Invalid delay 'soon' in terminal #0") {
+		t.Errorf("expected a warning about the delay, got\n%s", output)
+	}
+}
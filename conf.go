@@ -20,42 +20,81 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/gookit/color"
-	"gopkg.in/yaml.v2"
-	"io/ioutil"
-	"os/exec"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
-// CheckRequirements check system requirements to execute this tool
-func CheckRequirements() bool {
-	// check if qdbus is available
-	_, qdbusErr := exec.LookPath("qdbus")
-	if qdbusErr != nil {
-		color.Errorf("qdbus command is missing - probably it is not installed.\n")
+// CheckRequirements check system requirements to execute this tool and set up the yakuake backend
+func CheckRequirements(backend string) bool {
+	client, backendErr := NewYakuake(backend)
+	if backendErr != nil {
+		color.Errorf("%v\n", backendErr)
 		return false
 	}
-	_, yakuakeErr := exec.LookPath("yakuake")
-	if yakuakeErr != nil {
-		color.Errorf("yakuake command is missing - probably it is not installed.\n")
+	// ping yakuake
+	pingErr := client.Ping()
+	if pingErr != nil {
+		color.Errorf("yakuake is not reachable: %v\n", pingErr)
+		_ = client.Close()
 		return false
 	}
-	// ping yakuake
-	executeCmdVoid(DbusPathSessions, DbusMethodPing)
+	yakuake = client
 	return true
 }
 
-// ReadConfig read configuration and yaml stuff
+// ReadConfig read configuration and yaml stuff, including all files it includes
 func ReadConfig(filename string) (*YakCtlConfiguration, error) {
-	buf, err := ioutil.ReadFile(filename)
+	return ReadConfigFiles([]ConfigSource{{File: filename, Origin: ConfigOriginFlag}})
+}
+
+// ReadConfigFiles reads several configuration files as one configuration, the most specific file first.
+// Profiles and templates of a file replace the ones of the same name in the files following it.
+func ReadConfigFiles(files []ConfigSource) (*YakCtlConfiguration, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no configuration file given")
+	}
+	filename := files[0].File
+	loader := newConfigLoader()
+	var root *yaml.Node
+	for _, file := range files {
+		layer, err := loader.load(file.File, file.Origin, "")
+		if err != nil {
+			return nil, err
+		}
+		if root == nil {
+			root = layer
+			continue
+		}
+		if err := loader.layer(root, layer); err != nil {
+			return nil, err
+		}
+	}
+	validator := &configValidator{sources: loader.sources}
+	validator.checkFields(root, reflect.TypeOf(YakCtlConfiguration{}))
+	if len(validator.problems) > 0 {
+		return nil, validator.problems
+	}
+	err := resolveConfiguration(root, loader.sources)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid profiles: %v", err)
+	}
+	validator.checkProfiles(root)
+	if len(validator.problems) > 0 {
+		return nil, validator.problems
 	}
 	c := &YakCtlConfiguration{}
-	err = yaml.Unmarshal(buf, c)
+	err = root.Decode(c)
 	if err != nil {
 		return nil, fmt.Errorf("YAML syntax error in file: %q: %v", filename, err)
 	}
+	c.profileDirs = profileDirectories(root, loader.sources)
+	c.Sources = loader.files
+	c.Overrides = loader.overrides
 	return c, nil
 }
 
@@ -71,57 +110,166 @@ func PrintProfileList(configuration *YakCtlConfiguration) {
 	}
 }
 
-// PrintProfile print a single profile in yaml format
-func PrintProfile(configuration *YakCtlConfiguration, number int64) error {
-	profile, err := GetProfile(configuration, number)
+// PrintProfile print a single profile in yaml, json or toml format
+func PrintProfile(configuration *YakCtlConfiguration, name string, format string) error {
+	profile, err := GetProfile(configuration, name)
 	if err != nil {
 		return err
 	}
-	marshal, ymlErr := yaml.Marshal(profile)
-	if ymlErr != nil {
-		return fmt.Errorf("problem unmarshalling profile #%d to yaml format")
+	var node yaml.Node
+	if err := node.Encode(profile); err != nil {
+		return err
+	}
+	marshal, encodeErr := EncodeConfigNode(&node, format)
+	if encodeErr != nil {
+		return fmt.Errorf("problem marshalling profile '%s' to %s format: %v", profile.Name, format, encodeErr)
 	}
 	color.Info.Println(string(marshal))
 	return nil
 }
 
-// GetProfile retrieve session struct based on profile number
-func GetProfile(configuration *YakCtlConfiguration, number int64) (*ProfileDescription, error) {
-	err := fmt.Errorf("profile #%d does not exist", number)
-	if number <= 0 || int(number-1) > len(*configuration.Profiles) || len(*configuration.Profiles) == 0 {
-		return nil, err
+// GetProfile retrieve a profile by its name. If no profile has exactly this name, the name is tried as
+// profile number, then case-insensitive and finally as unique prefix of a profile name.
+func GetProfile(configuration *YakCtlConfiguration, name string) (*ProfileDescription, error) {
+	if configuration.Profiles == nil || len(*configuration.Profiles) == 0 {
+		return nil, fmt.Errorf("profile '%s' does not exist, no profiles defined", name)
+	}
+	profiles := *configuration.Profiles
+	for i := range profiles {
+		if profiles[i].Name == name {
+			return &profiles[i], nil
+		}
+	}
+	if number, err := strconv.Atoi(name); err == nil {
+		if number <= 0 || number > len(profiles) {
+			return nil, fmt.Errorf("profile #%d does not exist", number)
+		}
+		return &profiles[number-1], nil
+	}
+
+	matchers := []func(profileName string) bool{
+		func(profileName string) bool {
+			return strings.EqualFold(profileName, name)
+		},
+		func(profileName string) bool {
+			return strings.HasPrefix(strings.ToLower(profileName), strings.ToLower(name))
+		},
 	}
-	for i, v := range *configuration.Profiles {
-		if int64(i+1) == number {
-			return &v, nil
+	for _, matches := range matchers {
+		var candidates []*ProfileDescription
+		var candidateNames []string
+		for i := range profiles {
+			if matches(profiles[i].Name) {
+				candidates = append(candidates, &profiles[i])
+				candidateNames = append(candidateNames, "'"+profiles[i].Name+"'")
+			}
+		}
+		if len(candidates) == 1 {
+			return candidates[0], nil
+		}
+		if len(candidates) > 1 {
+			return nil, fmt.Errorf("profile name '%s' is ambiguous, it matches: %s", name, strings.Join(candidateNames, ", "))
 		}
 	}
-	return nil, err
+	return nil, fmt.Errorf("profile '%s' does not exist", name)
+}
+
+// marshal to yaml with the indentation used in the example configuration
+func marshalYAML(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// retrieve a profile by its name and fill in its variables
+func getRenderedProfile(configuration *YakCtlConfiguration, name string, variables map[string]string) (*ProfileDescription, error) {
+	profile, err := GetProfile(configuration, name)
+	if err != nil {
+		return nil, err
+	}
+	return renderProfile(profile, variables, configuration.profileDirs[profile.Name])
 }
 
 // YakCtlConfiguration this is the configuration object, yaml representation as struct
 type YakCtlConfiguration struct {
+	// files or glob patterns of further configuration files whose profiles and templates are added
+	Include  []string              `yaml:"include,omitempty"`
 	Profiles *[]ProfileDescription `yaml:"profiles"`
+	// tabs profiles can refer to by name, resolved when reading the configuration
+	Templates *[]TabDescription `yaml:"templates,omitempty"`
+	// all files the configuration was read from
+	Sources []ConfigSource `yaml:"-"`
+	// descriptions of the profiles and templates replaced by the ones of a more specific file
+	Overrides []string `yaml:"-"`
+	// directories of the files the profiles are defined in, by profile name
+	profileDirs map[string]string `yaml:"-"`
 }
 
 // ProfileDescription represents a session description
 type ProfileDescription struct {
-	Name       string           `yaml:"name"`
-	Tabs       []TabDescription `yaml:"tabs"`
-	ClearAll   bool             `yaml:"clear,omitempty"`
-	ForceClear bool             `yaml:"force,omitempty"`
+	Name string `yaml:"name"`
+	// name of a profile whose tabs and flags are inherited, resolved when reading the configuration
+	Extends string `yaml:"extends,omitempty"`
+	// variables used in tab names and commands, variables without default value have to be set when opening the profile
+	Vars       map[string]*string `yaml:"vars,omitempty"`
+	Tabs       []TabDescription   `yaml:"tabs"`
+	ClearAll   bool               `yaml:"clear,omitempty"`
+	ForceClear bool               `yaml:"force,omitempty"`
+}
+
+// the panes of a tab with the commands of terminal1 to terminal4 appended to the commands of the first four panes
+func (tab *TabDescription) terminalPanes() []PaneDescription {
+	panes := append([]PaneDescription(nil), tab.Panes...)
+	for i, commands := range [][]Command{tab.Terminal1, tab.Terminal2, tab.Terminal3, tab.Terminal4} {
+		if len(commands) == 0 {
+			continue
+		}
+		for len(panes) <= i {
+			panes = append(panes, PaneDescription{})
+		}
+		panes[i].Commands = append(append([]Command(nil), panes[i].Commands...), commands...)
+	}
+	return panes
+}
+
+// PaneDescription represents a single terminal of a tab
+type PaneDescription struct {
+	// name of the pane, for reference
+	Name     string    `yaml:"name,omitempty"`
+	Commands []Command `yaml:"commands,omitempty"`
+	// working directory the commands are executed in, the one of the tab if empty
+	Workdir string `yaml:"workdir,omitempty"`
+	// environment variables exported before the commands, added to the ones of the tab
+	Env                  map[string]string `yaml:"env,omitempty"`
+	DisableKeyboardInput bool              `yaml:"disableInput,omitempty"`
 }
 
 // TabDescription represents a tab of a yakuake session
 type TabDescription struct {
 	Name string `yaml:"name"`
+	// name of a template this tab is based on, resolved when reading the configuration
+	Template string `yaml:"template,omitempty"`
+	// working directory and environment variables of all panes, applied before the commands
+	Workdir string            `yaml:"workdir,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
 	// optional
-	Commands  []string `yaml:"commands,omitempty"`
-	SplitMode string   `yaml:"split,omitempty"`
-	Terminal1 []string `yaml:"terminal1,omitempty"`
-	Terminal2 []string `yaml:"terminal2,omitempty"`
-	Terminal3 []string `yaml:"terminal3,omitempty"`
-	Terminal4 []string `yaml:"terminal4,omitempty"`
+	Commands  []Command `yaml:"commands,omitempty"`
+	SplitMode string    `yaml:"split,omitempty"`
+	Terminal1 []Command `yaml:"terminal1,omitempty"`
+	Terminal2 []Command `yaml:"terminal2,omitempty"`
+	Terminal3 []Command `yaml:"terminal3,omitempty"`
+	Terminal4 []Command `yaml:"terminal4,omitempty"`
+	// the terminals of the tab in the order of their ids, terminal1 to terminal4 are aliases of the commands of the first four
+	Panes []PaneDescription `yaml:"panes,omitempty"`
+	// panes of the tab, instead of split and terminal1 to terminal4
+	Layout *LayoutDescription `yaml:"layout,omitempty"`
 	// flags
 	Protected            bool `yaml:"protected,omitempty"`
 	MonitorSilence       bool `yaml:"monitorSilence,omitempty"`
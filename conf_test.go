@@ -0,0 +1,76 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetProfile(t *testing.T) {
+	configuration := &YakCtlConfiguration{Profiles: &[]ProfileDescription{
+		{Name: "backend"}, {Name: "Backend-Logs"}, {Name: "monitoring"}, {Name: "2"},
+	}}
+	for _, testCase := range []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{input: "backend", expected: "backend"},
+		{input: "2", expected: "2"},
+		{input: "3", expected: "monitoring"},
+		{input: "MONITORING", expected: "monitoring"},
+		{input: "mon", expected: "monitoring"},
+		{input: "backend-l", expected: "Backend-Logs"},
+		{input: "back", err: "ambiguous, it matches: 'backend', 'Backend-Logs'"},
+		{input: "5", err: "profile #5 does not exist"},
+		{input: "frontend", err: "profile 'frontend' does not exist"},
+	} {
+		profile, err := GetProfile(configuration, testCase.input)
+		if len(testCase.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("%s: expected error '%s', got %v", testCase.input, testCase.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", testCase.input, err)
+			continue
+		}
+		if profile.Name != testCase.expected {
+			t.Errorf("%s: expected profile '%s', got '%s'", testCase.input, testCase.expected, profile.Name)
+		}
+	}
+}
+
+func TestReadConfigDuplicateProfileNames(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".yakctl.yml")
+	content := "profiles:\n  - name: work\n  - name: home\n  - name: work\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ReadConfig(file)
+	if err == nil || !strings.Contains(err.Error(), ".yakctl.yml:4:11: profile 'work' is already defined at "+file+":2:11") {
+		t.Errorf("expected a duplicate name error, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"github.com/emschu/yakctl/internal/fakeyakuake"
+	"github.com/godbus/dbus/v5"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// start a private session bus, it is used by all backends created afterwards
+func startSessionBus(t *testing.T) string {
+	t.Helper()
+	daemon, lookErr := exec.LookPath("dbus-daemon")
+	if lookErr != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+	cmd := exec.Command(daemon, "--session", "--nofork", "--nopidfile", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("unable to read address of dbus-daemon: %v", err)
+	}
+	address = strings.TrimSpace(address)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+	return address
+}
+
+// start a private session bus with a simulated yakuake
+func newDbusYakuake(t *testing.T) *fakeyakuake.Yakuake {
+	t.Helper()
+	address := startSessionBus(t)
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	fake := fakeyakuake.New()
+	if _, err := fake.AddSession(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.Serve(conn); err != nil {
+		t.Fatal(err)
+	}
+	return fake
+}
+
+func TestDbusBackend(t *testing.T) {
+	fake := newDbusYakuake(t)
+	captureOutput(t)
+	client, err := NewYakuake(BackendDbus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	yakuake = client
+	t.Cleanup(func() {
+		yakuake = nil
+	})
+	if err := client.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	configuration, err := ReadConfig(".yakctl.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadSession(configuration, "default"); err != nil {
+		t.Fatal(err)
+	}
+
+	if sessions := fake.Sessions(); len(sessions) != 6 {
+		t.Fatalf("expected 6 sessions, got\n%s", fake)
+	}
+	quad := sessionByTitle(t, fake, "quad_tab")
+	if quad.KeyboardInputEnabled || !quad.MonitorActivity || len(quad.Terminals) != 4 {
+		t.Errorf("unexpected quad session %+v", quad)
+	}
+	if commands := fake.Commands(quad.Terminals[3]); !reflect.DeepEqual(commands, []string{"echo 'all'", `echo "terminal4"`}) {
+		t.Errorf("unexpected commands %v", commands)
+	}
+	visible, err := client.IsWindowVisible()
+	if err != nil || !visible {
+		t.Errorf("window should be visible: %v %v", visible, err)
+	}
+}
+
+func TestDbusBackendErrorReply(t *testing.T) {
+	fake := newDbusYakuake(t)
+	client, err := NewYakuake(BackendDbus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	fake.SetError("AddSessionQuad", errors.New("too many tabs"))
+
+	_, addErr := client.AddSessionQuad()
+	if addErr == nil || !strings.Contains(addErr.Error(), "too many tabs") {
+		t.Errorf("expected the error of yakuake, got %v", addErr)
+	}
+}
+
+func TestDbusBackendKonsoleSessions(t *testing.T) {
+	fake := newDbusYakuake(t)
+	client, err := NewYakuake(BackendDbus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// a konsole session of another part lets the ids of konsole sessions and terminals diverge
+	fake.RemoveKonsoleSession(fake.AddKonsoleSession())
+	sessionID, err := fake.AddSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	terminalIDs, _ := fake.TerminalIDsForSessionID(sessionID)
+
+	if err := client.SendTextToTerminal(terminalIDs[0], "ls\n"); err != nil {
+		t.Fatal(err)
+	}
+	if sent := fake.SentText(terminalIDs[0]); !reflect.DeepEqual(sent, []string{"ls\n"}) {
+		t.Errorf("text should be sent to terminal #%d, got %v", terminalIDs[0], sent)
+	}
+	pid, err := client.TerminalShellPID(terminalIDs[0])
+	expected, _ := fake.TerminalShellPID(terminalIDs[0])
+	if err != nil || pid != expected {
+		t.Errorf("expected shell %d of terminal #%d, got %d %v", expected, terminalIDs[0], pid, err)
+	}
+
+	// with an open konsole session of another part the session of a terminal is unknown
+	fake.AddKonsoleSession()
+	if _, err := client.TerminalText(terminalIDs[0]); err == nil || !strings.Contains(err.Error(), "konsole session of terminal") {
+		t.Errorf("expected an unknown konsole session, got %v", err)
+	}
+}
+
+func TestDbusBackendMissingService(t *testing.T) {
+	startSessionBus(t)
+	client, err := NewYakuake(BackendDbus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	pingErr := client.Ping()
+	if pingErr == nil || !strings.Contains(pingErr.Error(), "is not available") {
+		t.Errorf("expected a missing service, got %v", pingErr)
+	}
+}
+
+// run the yakctl binary against the simulated yakuake like a user would do
+func TestYakctlEndToEnd(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building the binary is skipped in short mode")
+	}
+	fake := newDbusYakuake(t)
+	binary := filepath.Join(t.TempDir(), "yakctl")
+	if output, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput(); err != nil {
+		t.Fatalf("unable to build yakctl: %v\n%s", err, output)
+	}
+
+	output, err := exec.Command(binary, "--config", ".yakctl.yml", "profile", "open", "2").CombinedOutput()
+	if err != nil {
+		t.Fatalf("yakctl failed: %v\n%s", err, output)
+	}
+	session := sessionByTitle(t, fake, "raspi3_ssh")
+	if session.Closable {
+		t.Errorf("session should be protected: %+v", session)
+	}
+
+	output, err = exec.Command(binary, "--config", ".yakctl.yml", "status").CombinedOutput()
+	if err != nil {
+		t.Fatalf("yakctl failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(string(output), "tab title: raspi3_ssh") {
+		t.Errorf("status does not contain the new tab:\n%s", output)
+	}
+}
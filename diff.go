@@ -0,0 +1,169 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gookit/color"
+	"strings"
+)
+
+// DiffProfile prints what opening a profile, or applying it with apply, would change as text or json
+func DiffProfile(configuration *YakCtlConfiguration, profileName string, variables map[string]string, apply bool, prune bool, force bool, format string) error {
+	if !apply && (prune || force) {
+		return fmt.Errorf("'--prune' and '--force' are options of 'profile apply', compare with it using '--apply'")
+	}
+	profile, err := getRenderedProfile(configuration, profileName, variables)
+	if err != nil {
+		return err
+	}
+	if err := checkVariablesDeclared([]*ProfileDescription{profile}, variables); err != nil {
+		return err
+	}
+	var plan *Plan
+	if apply {
+		plan, err = PlanProfile(profile, prune || profile.ClearAll, force || profile.ForceClear)
+	} else {
+		plan, err = PlanOpen(profile)
+	}
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		return PrintPlanJSON(plan)
+	case "text":
+		PrintPlan(plan)
+		return nil
+	default:
+		return fmt.Errorf("invalid output format '%s'", format)
+	}
+}
+
+// PlanOpen describes what opening a profile would change: every tab is created anew and,
+// if the profile clears, all existing sessions are closed
+func PlanOpen(profile *ProfileDescription) (*Plan, error) {
+	states, err := readSessionStates()
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{Profile: profile.Name, Prune: profile.ClearAll, Force: profile.ForceClear}
+	for i := range profile.Tabs {
+		tab := &profile.Tabs[i]
+		plan.Actions = append(plan.Actions, PlanAction{Action: ActionCreate, SessionID: -1, Title: tab.Name, Tab: tab})
+	}
+	for _, state := range states {
+		action := PlanAction{Action: ActionUnmanaged, SessionID: state.ID, Title: state.Title, Protected: state.Protected}
+		if plan.Prune && (!state.Protected || plan.Force) {
+			action.Action = ActionClose
+		}
+		plan.Actions = append(plan.Actions, action)
+	}
+	return plan, nil
+}
+
+// PrintPlan prints a plan in a diff like format
+func PrintPlan(plan *Plan) {
+	var options []string
+	if plan.Prune {
+		options = append(options, "prune")
+	}
+	if plan.Force {
+		options = append(options, "force")
+	}
+	if len(options) > 0 {
+		color.Info.Printf("Plan for profile '%s' (%s)\n", plan.Profile, strings.Join(options, ", "))
+	} else {
+		color.Info.Printf("Plan for profile '%s'\n", plan.Profile)
+	}
+
+	counts := map[string]int{}
+	for _, action := range plan.Actions {
+		counts[action.Action]++
+		switch action.Action {
+		case ActionCreate:
+			color.Green.Printf("+ create    '%s'%s\n", action.Title, describeTab(action.Tab))
+		case ActionUpdate:
+			if len(action.NewTitle) > 0 {
+				color.Yellow.Printf("~ update    #%d '%s' -> '%s'\n", action.SessionID, action.Title, action.NewTitle)
+			} else {
+				color.Yellow.Printf("~ update    #%d '%s'\n", action.SessionID, action.Title)
+			}
+			for _, change := range action.Changes {
+				color.Yellow.Printf("      %s: %v -> %v\n", change.Flag, change.From, change.To)
+			}
+		case ActionClose:
+			color.Red.Printf("- close     #%d '%s'%s\n", action.SessionID, action.Title, protectedNote(action.Protected))
+		case ActionUnchanged:
+			color.Normal.Printf("  unchanged #%d '%s'\n", action.SessionID, action.Title)
+		case ActionUnmanaged:
+			color.Normal.Printf("  keep      #%d '%s'%s\n", action.SessionID, action.Title, protectedNote(action.Protected))
+		}
+	}
+	color.Info.Printf("%d to create, %d to update, %d to close\n", counts[ActionCreate], counts[ActionUpdate], counts[ActionClose])
+}
+
+// PrintPlanJSON prints a plan in json format
+func PrintPlanJSON(plan *Plan) error {
+	marshal, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(marshal))
+	return nil
+}
+
+// short description of the layout and flags of a tab
+func describeTab(tab *TabDescription) string {
+	if tab == nil {
+		return ""
+	}
+	var details []string
+	if len(tab.SplitMode) > 0 {
+		details = append(details, "split: "+tab.SplitMode)
+	}
+	if tab.Layout != nil {
+		details = append(details, fmt.Sprintf("layout: %d panes", tab.Layout.paneCount()))
+	}
+	if tab.Protected {
+		details = append(details, "protected")
+	}
+	if tab.MonitorSilence {
+		details = append(details, "monitorSilence")
+	}
+	if tab.MonitorActivity {
+		details = append(details, "monitorActivity")
+	}
+	if tab.DisableKeyboardInput {
+		details = append(details, "disableInput")
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(details, ", ") + ")"
+}
+
+func protectedNote(protected bool) string {
+	if protected {
+		return " (protected)"
+	}
+	return ""
+}
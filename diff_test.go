@@ -0,0 +1,136 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPrintPlan(t *testing.T) {
+	fake := newFakeYakuake(t)
+	output := captureOutput(t)
+	editorID, _ := fake.AddSession()
+	_ = fake.SetTabTitle(editorID, "EDITOR")
+	protectedID, _ := fake.AddSession()
+	_ = fake.SetSessionClosable(protectedID, false)
+	profile := &ProfileDescription{Name: "work", Tabs: []TabDescription{
+		{Name: "editor", MonitorActivity: true},
+		{Name: "logs", SplitMode: "lr", Protected: true},
+	}}
+
+	plan, err := PlanProfile(profile, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	PrintPlan(plan)
+
+	for _, expected := range []string{
+		"Plan for profile 'work' (prune)",
+		"~ update    #1 'EDITOR' -> 'editor'",
+		"monitorActivity: false -> true",
+		"+ create    'logs' (split: lr, protected)",
+		"- close     #0 'Shell No. 1'",
+		"  keep      #2 'Shell No. 3' (protected)",
+		"1 to create, 1 to update, 1 to close",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("missing '%s' in output:\n%s", expected, output)
+		}
+	}
+	if len(fake.Sessions()) != 3 {
+		t.Errorf("planning must not change anything, got\n%s", fake)
+	}
+}
+
+func TestPlanOpen(t *testing.T) {
+	fake := newFakeYakuake(t)
+	protectedID, _ := fake.AddSession()
+	_ = fake.SetSessionClosable(protectedID, false)
+	configuration, err := ReadConfig(".yakctl.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, _ := GetProfile(configuration, "default")
+
+	plan, err := PlanOpen(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshal, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Profile string
+		Force   bool
+		Actions []struct {
+			Action    string
+			SessionID int
+		}
+	}
+	if err := json.Unmarshal(marshal, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Profile != "default" || !decoded.Force || len(decoded.Actions) != len(profile.Tabs)+2 {
+		t.Fatalf("unexpected plan %s", marshal)
+	}
+	for _, action := range decoded.Actions[len(profile.Tabs):] {
+		if action.Action != ActionClose {
+			t.Errorf("forced clear should close session #%d: %s", action.SessionID, marshal)
+		}
+	}
+}
+
+func TestDiffProfileUndeclaredVariable(t *testing.T) {
+	newFakeYakuake(t)
+	captureOutput(t)
+	configuration := readTestConfig(t, "profiles:\n  - name: work\n    vars:\n      dir: /tmp\n    tabs:\n      - name: \"{{ .dir }}\"\n")
+
+	err := DiffProfile(configuration, "work", map[string]string{"typo": "x"}, true, false, false, "text")
+	if err == nil || !strings.Contains(err.Error(), "variable 'typo' is not declared") {
+		t.Errorf("expected an error about the undeclared variable, got %v", err)
+	}
+}
+
+func TestDiffProfileOpensByDefault(t *testing.T) {
+	newFakeYakuake(t)
+	output := captureOutput(t)
+	configuration := readTestConfig(t, "profiles:\n  - name: work\n    tabs:\n      - name: Shell No. 1\n")
+
+	if err := DiffProfile(configuration, "work", nil, false, false, false, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "+ create    'Shell No. 1'") {
+		t.Errorf("opening creates every tab, even existing ones:\n%s", output)
+	}
+	output.Reset()
+	if err := DiffProfile(configuration, "work", nil, true, false, false, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(output.String(), "+ create") {
+		t.Errorf("applying keeps existing tabs:\n%s", output)
+	}
+	if err := DiffProfile(configuration, "work", nil, false, true, false, "text"); err == nil {
+		t.Errorf("expected an error for --prune without --apply")
+	}
+}
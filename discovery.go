@@ -0,0 +1,169 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// why a configuration file was read
+const (
+	ConfigOriginFlag    = "--config"
+	ConfigOriginEnv     = "$YAKCTL_CONFIG"
+	ConfigOriginProject = "project"
+	ConfigOriginUser    = "user"
+	ConfigOriginLegacy  = "legacy"
+	ConfigOriginInclude = "include"
+)
+
+// names of the configuration files searched for
+const (
+	configFileName = ".yakctl.yml"
+	configEnvVar   = "YAKCTL_CONFIG"
+)
+
+// extensions of project and user configuration files, in order of preference
+var configExtensions = []string{".yml", ".yaml", ".json", ".toml"}
+
+// ConfigSource describes a file a configuration was read from
+type ConfigSource struct {
+	File string
+	// why the file was read, one of the ConfigOrigin constants
+	Origin string
+	// the file including this file, if it was included
+	IncludedBy string
+}
+
+// DiscoverConfigFiles returns the configuration files to read, the most specific one first.
+// A file given by --config or $YAKCTL_CONFIG is read alone. Otherwise a .yakctl.yml in the working directory
+// or one of its parents is read on top of the user's configuration, which is
+// $XDG_CONFIG_HOME/yakctl/config.yml or - if this file does not exist - ~/.yakctl.yml.
+func DiscoverConfigFiles(configFlag string, workingDir string) ([]ConfigSource, error) {
+	if len(configFlag) > 0 {
+		return []ConfigSource{{File: configFlag, Origin: ConfigOriginFlag}}, nil
+	}
+	if file := os.Getenv(configEnvVar); len(file) > 0 {
+		return []ConfigSource{{File: file, Origin: ConfigOriginEnv}}, nil
+	}
+
+	var candidates []ConfigSource
+	if configDir, err := os.UserConfigDir(); err == nil {
+		for _, extension := range configExtensions {
+			candidates = append(candidates, ConfigSource{File: filepath.Join(configDir, "yakctl", "config"+extension), Origin: ConfigOriginUser})
+		}
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, ConfigSource{File: filepath.Join(homeDir, configFileName), Origin: ConfigOriginLegacy})
+	}
+
+	var files []ConfigSource
+	if project := findProjectConfig(workingDir, candidates); len(project) > 0 {
+		files = append(files, ConfigSource{File: project, Origin: ConfigOriginProject})
+	}
+	for _, candidate := range candidates {
+		if isFile(candidate.File) {
+			files = append(files, candidate)
+			break
+		}
+	}
+	if len(files) == 0 {
+		var searched []string
+		for _, candidate := range candidates {
+			searched = append(searched, candidate.File)
+		}
+		return nil, fmt.Errorf("no configuration file found: searched for .yakctl%s in '%s' and its parents, %s",
+			strings.Join(configExtensions, ", .yakctl"), workingDir, strings.Join(searched, ", "))
+	}
+	return files, nil
+}
+
+// find the nearest .yakctl.yml (or .yaml, .json, .toml) in a directory or its parents,
+// which is not one of the user's configuration files
+func findProjectConfig(dir string, userFiles []ConfigSource) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		for _, extension := range configExtensions {
+			candidate := filepath.Join(dir, ".yakctl"+extension)
+			isUserFile := false
+			for _, userFile := range userFiles {
+				isUserFile = isUserFile || filepath.Clean(userFile.File) == candidate
+			}
+			if !isUserFile && isFile(candidate) {
+				return candidate
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// the legacy ~/.yakctl.yml, if it exists but is not read because the user's configuration is found in the
+// XDG directory, and the file read instead
+func ignoredLegacyConfig(files []ConfigSource) (string, string) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", ""
+	}
+	legacy := filepath.Join(homeDir, configFileName)
+	for _, file := range files {
+		if file.Origin == ConfigOriginUser && isFile(legacy) {
+			return legacy, file.File
+		}
+	}
+	return "", ""
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// PrintConfigSources prints the files a configuration was read from and how they were merged
+func PrintConfigSources(configuration *YakCtlConfiguration) {
+	color.Info.Printf("Configuration files, the first one takes precedence:\n")
+	for _, source := range configuration.Sources {
+		if source.Origin == ConfigOriginInclude {
+			color.Printf("    %s (included by %s)\n", source.File, source.IncludedBy)
+			continue
+		}
+		color.Printf("  %s (%s)\n", source.File, source.Origin)
+	}
+	if legacy, userFile := ignoredLegacyConfig(configuration.Sources); len(legacy) > 0 {
+		color.Warn.Printf("Ignored files:\n")
+		color.Printf("  %s (%s, replaced by %s)\n", legacy, ConfigOriginLegacy, userFile)
+	}
+	if len(configuration.Overrides) == 0 {
+		return
+	}
+	color.Info.Printf("Replaced profiles and templates:\n")
+	for _, override := range configuration.Overrides {
+		color.Printf("  %s\n", override)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscoverConfigFiles(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"home/.yakctl.yml":                "profiles: []\n",
+		"home/.config/yakctl/config.yml":  "profiles: []\n",
+		"home/src/project/.yakctl.yml":    "profiles: []\n",
+		"home/src/project/sub/readme.txt": "",
+	})
+	home := filepath.Join(dir, "home")
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv(configEnvVar, "")
+
+	files, err := DiscoverConfigFiles("", filepath.Join(home, "src", "project", "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ConfigSource{
+		{File: filepath.Join(home, "src", "project", ".yakctl.yml"), Origin: ConfigOriginProject},
+		{File: filepath.Join(home, ".config", "yakctl", "config.yml"), Origin: ConfigOriginUser},
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("unexpected files %+v", files)
+	}
+
+	// the legacy file is used without XDG configuration and is no project file
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "missing"))
+	files, err = DiscoverConfigFiles("", filepath.Join(home, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []ConfigSource{{File: filepath.Join(home, ".yakctl.yml"), Origin: ConfigOriginLegacy}}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("unexpected files %+v", files)
+	}
+
+	t.Setenv(configEnvVar, "/env.yml")
+	files, _ = DiscoverConfigFiles("", home)
+	if !reflect.DeepEqual(files, []ConfigSource{{File: "/env.yml", Origin: ConfigOriginEnv}}) {
+		t.Errorf("unexpected files %+v", files)
+	}
+	files, _ = DiscoverConfigFiles("/flag.yml", home)
+	if !reflect.DeepEqual(files, []ConfigSource{{File: "/flag.yml", Origin: ConfigOriginFlag}}) {
+		t.Errorf("unexpected files %+v", files)
+	}
+}
+
+func TestDiscoverConfigFilesMissing(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, ".config"))
+	t.Setenv(configEnvVar, "")
+
+	_, err := DiscoverConfigFiles("", dir)
+	if err == nil || !strings.Contains(err.Error(), "no configuration file found") {
+		t.Errorf("expected an error, got %v", err)
+	}
+}
+
+func TestReadConfigFilesLayered(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"project.yml": "profiles:\n  - name: work\n    tabs:\n      - template: ssh\n",
+		"user.yml":    "templates:\n  - name: ssh\n    commands:\n      - ssh pi\nprofiles:\n  - name: home\n  - name: work\n    clear: true\n",
+	})
+	configuration, err := ReadConfigFiles([]ConfigSource{
+		{File: filepath.Join(dir, "project.yml"), Origin: ConfigOriginProject},
+		{File: filepath.Join(dir, "user.yml"), Origin: ConfigOriginUser},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*configuration.Profiles) != 2 {
+		t.Fatalf("unexpected profiles %+v", *configuration.Profiles)
+	}
+	work, _ := GetProfile(configuration, "work")
+	if work.ClearAll || !reflect.DeepEqual(work.Tabs[0].Commands, []Command{{Run: "ssh pi"}}) {
+		t.Errorf("expected the project profile using the user template, got %+v", work)
+	}
+	if len(configuration.Overrides) != 1 || !strings.Contains(configuration.Overrides[0], "profile 'work' at "+filepath.Join(dir, "project.yml")+":2:11 replaces") {
+		t.Errorf("unexpected overrides %v", configuration.Overrides)
+	}
+
+	buf := captureOutput(t)
+	PrintConfigSources(configuration)
+	output := buf.String()
+	if !strings.Contains(output, filepath.Join(dir, "user.yml")+" (user)") || !strings.Contains(output, "replaces the one at") {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+}
+
+func TestIgnoredLegacyConfig(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"home/.yakctl.yml":               "profiles:\n  - name: old\n",
+		"home/.config/yakctl/config.yml": "profiles:\n  - name: new\n",
+	})
+	home := filepath.Join(dir, "home")
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv(configEnvVar, "")
+	files, err := DiscoverConfigFiles("", home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configuration, err := ReadConfigFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := captureOutput(t)
+	PrintConfigSources(configuration)
+	if output := buf.String(); !strings.Contains(output, "Ignored files") || !strings.Contains(output, filepath.Join(home, ".yakctl.yml")+" (legacy") {
+		t.Errorf("the legacy file should be listed as ignored:\n%s", output)
+	}
+	buf.Reset()
+	if !ValidateConfiguration(files) || !strings.Contains(buf.String(), filepath.Join(home, ".yakctl.yml")+" is ignored") {
+		t.Errorf("expected a warning about the legacy file:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,300 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+)
+
+// ids of sessions and terminals which would be created start here, to not collide with existing ones
+const dryRunIDBase = 1000000
+
+// dryRunYakuake performs all read-only calls on the wrapped yakuake instance and records all changing calls
+// instead of performing them. Every method is implemented explicitly, so new changing calls are not passed through by accident.
+type dryRunYakuake struct {
+	yakuake         Yakuake
+	operations      []string
+	nextID          int
+	plannedSessions map[int][]int
+	plannedTitles   map[int]string
+}
+
+func newDryRunYakuake(yakuake Yakuake) *dryRunYakuake {
+	return &dryRunYakuake{
+		yakuake:         yakuake,
+		nextID:          dryRunIDBase,
+		plannedSessions: map[int][]int{},
+		plannedTitles:   map[int]string{},
+	}
+}
+
+// Operations returns the recorded calls in order
+func (d *dryRunYakuake) Operations() []string {
+	return d.operations
+}
+
+// PrintSummary prints the number of recorded calls
+func (d *dryRunYakuake) PrintSummary() {
+	color.Info.Printf("Dry run: %d operation(s) would be performed\n", len(d.operations))
+}
+
+func (d *dryRunYakuake) record(format string, args ...interface{}) {
+	operation := fmt.Sprintf(format, args...)
+	d.operations = append(d.operations, operation)
+	color.Cyan.Printf("[dry-run] %s\n", operation)
+}
+
+func (d *dryRunYakuake) addSession(method string, terminalCount int) (int, error) {
+	sessionID := d.nextID
+	d.nextID++
+	var terminals []int
+	for i := 0; i < terminalCount; i++ {
+		terminals = append(terminals, d.nextID)
+		d.nextID++
+	}
+	d.plannedSessions[sessionID] = terminals
+	d.record("%s() = %d", method, sessionID)
+	return sessionID, nil
+}
+
+func (d *dryRunYakuake) isPlanned(sessionID int) bool {
+	_, ok := d.plannedSessions[sessionID]
+	return ok
+}
+
+func (d *dryRunYakuake) Ping() error {
+	return d.yakuake.Ping()
+}
+
+func (d *dryRunYakuake) Close() error {
+	return d.yakuake.Close()
+}
+
+func (d *dryRunYakuake) Simulated() bool {
+	return true
+}
+
+func (d *dryRunYakuake) AddSession() (int, error) {
+	return d.addSession("addSession", 1)
+}
+
+func (d *dryRunYakuake) AddSessionTwoHorizontal() (int, error) {
+	return d.addSession("addSessionTwoHorizontal", 2)
+}
+
+func (d *dryRunYakuake) AddSessionTwoVertical() (int, error) {
+	return d.addSession("addSessionTwoVertical", 2)
+}
+
+func (d *dryRunYakuake) AddSessionQuad() (int, error) {
+	return d.addSession("addSessionQuad", 4)
+}
+
+func (d *dryRunYakuake) ActiveSessionID() (int, error) {
+	return d.yakuake.ActiveSessionID()
+}
+
+func (d *dryRunYakuake) SessionIDs() ([]int, error) {
+	return d.yakuake.SessionIDs()
+}
+
+func (d *dryRunYakuake) IsSessionClosable(sessionID int) (bool, error) {
+	if d.isPlanned(sessionID) {
+		return true, nil
+	}
+	return d.yakuake.IsSessionClosable(sessionID)
+}
+
+func (d *dryRunYakuake) SetSessionClosable(sessionID int, closable bool) error {
+	d.record("setSessionClosable(%d, %v)", sessionID, closable)
+	return nil
+}
+
+func (d *dryRunYakuake) SetSessionMonitorSilenceEnabled(sessionID int, enabled bool) error {
+	d.record("setSessionMonitorSilenceEnabled(%d, %v)", sessionID, enabled)
+	return nil
+}
+
+func (d *dryRunYakuake) SetSessionMonitorActivityEnabled(sessionID int, enabled bool) error {
+	d.record("setSessionMonitorActivityEnabled(%d, %v)", sessionID, enabled)
+	return nil
+}
+
+func (d *dryRunYakuake) SetSessionKeyboardInputEnabled(sessionID int, enabled bool) error {
+	d.record("setSessionKeyboardInputEnabled(%d, %v)", sessionID, enabled)
+	return nil
+}
+
+func (d *dryRunYakuake) IsSessionMonitorSilenceEnabled(sessionID int) (bool, error) {
+	if d.isPlanned(sessionID) {
+		return false, nil
+	}
+	return d.yakuake.IsSessionMonitorSilenceEnabled(sessionID)
+}
+
+func (d *dryRunYakuake) IsSessionMonitorActivityEnabled(sessionID int) (bool, error) {
+	if d.isPlanned(sessionID) {
+		return false, nil
+	}
+	return d.yakuake.IsSessionMonitorActivityEnabled(sessionID)
+}
+
+func (d *dryRunYakuake) IsSessionKeyboardInputEnabled(sessionID int) (bool, error) {
+	if d.isPlanned(sessionID) {
+		return true, nil
+	}
+	return d.yakuake.IsSessionKeyboardInputEnabled(sessionID)
+}
+
+func (d *dryRunYakuake) ActiveTerminalID() (int, error) {
+	return d.yakuake.ActiveTerminalID()
+}
+
+func (d *dryRunYakuake) TerminalIDs() ([]int, error) {
+	return d.yakuake.TerminalIDs()
+}
+
+func (d *dryRunYakuake) TerminalIDsForSessionID(sessionID int) ([]int, error) {
+	if terminals, ok := d.plannedSessions[sessionID]; ok {
+		return terminals, nil
+	}
+	return d.yakuake.TerminalIDsForSessionID(sessionID)
+}
+
+func (d *dryRunYakuake) SessionIDForTerminalID(terminalID int) (int, error) {
+	for sessionID, terminals := range d.plannedSessions {
+		for _, id := range terminals {
+			if id == terminalID {
+				return sessionID, nil
+			}
+		}
+	}
+	return d.yakuake.SessionIDForTerminalID(terminalID)
+}
+
+func (d *dryRunYakuake) RunCommandInTerminal(terminalID int, command string) error {
+	d.record("runCommandInTerminal(%d, %q)", terminalID, command)
+	return nil
+}
+
+func (d *dryRunYakuake) RemoveTerminal(terminalID int) error {
+	d.record("removeTerminal(%d)", terminalID)
+	return nil
+}
+
+func (d *dryRunYakuake) SetTerminalKeyboardInputEnabled(terminalID int, enabled bool) error {
+	d.record("setTerminalKeyboardInputEnabled(%d, %v)", terminalID, enabled)
+	return nil
+}
+
+func (d *dryRunYakuake) IsTerminalKeyboardInputEnabled(terminalID int) (bool, error) {
+	if sessionID, err := d.SessionIDForTerminalID(terminalID); err == nil && d.isPlanned(sessionID) {
+		return true, nil
+	}
+	return d.yakuake.IsTerminalKeyboardInputEnabled(terminalID)
+}
+
+func (d *dryRunYakuake) SplitTerminalLeftRight(terminalID int) (int, error) {
+	return d.splitTerminal("splitTerminalLeftRight", terminalID)
+}
+
+func (d *dryRunYakuake) SplitTerminalTopBottom(terminalID int) (int, error) {
+	return d.splitTerminal("splitTerminalTopBottom", terminalID)
+}
+
+// splits of existing terminals are planned like new sessions, the new terminal belongs to the session of the terminal
+func (d *dryRunYakuake) splitTerminal(method string, terminalID int) (int, error) {
+	sessionID, err := d.SessionIDForTerminalID(terminalID)
+	if err != nil {
+		return -1, err
+	}
+	newTerminalID := d.nextID
+	d.nextID++
+	if d.isPlanned(sessionID) {
+		d.plannedSessions[sessionID] = append(d.plannedSessions[sessionID], newTerminalID)
+	}
+	d.record("%s(%d) = %d", method, terminalID, newTerminalID)
+	return newTerminalID, nil
+}
+
+func (d *dryRunYakuake) TerminalWorkingDirectory(terminalID int) (string, error) {
+	return d.yakuake.TerminalWorkingDirectory(terminalID)
+}
+
+func (d *dryRunYakuake) TerminalShellPID(terminalID int) (int, error) {
+	if err := d.checkNotPlanned(terminalID); err != nil {
+		return 0, err
+	}
+	return d.yakuake.TerminalShellPID(terminalID)
+}
+
+func (d *dryRunYakuake) TerminalForegroundProcess(terminalID int) (int, string, error) {
+	if err := d.checkNotPlanned(terminalID); err != nil {
+		return 0, "", err
+	}
+	return d.yakuake.TerminalForegroundProcess(terminalID)
+}
+
+func (d *dryRunYakuake) TerminalText(terminalID int) (string, error) {
+	if err := d.checkNotPlanned(terminalID); err != nil {
+		return "", err
+	}
+	return d.yakuake.TerminalText(terminalID)
+}
+
+func (d *dryRunYakuake) SendTextToTerminal(terminalID int, text string) error {
+	d.record("sendText(%d, %q)", terminalID, text)
+	return nil
+}
+
+// planned terminals have no processes and no output
+func (d *dryRunYakuake) checkNotPlanned(terminalID int) error {
+	if sessionID, err := d.SessionIDForTerminalID(terminalID); err == nil && d.isPlanned(sessionID) {
+		return fmt.Errorf("terminal #%d is only planned", terminalID)
+	}
+	return nil
+}
+
+func (d *dryRunYakuake) TabTitle(sessionID int) (string, error) {
+	if title, ok := d.plannedTitles[sessionID]; ok {
+		return title, nil
+	}
+	return d.yakuake.TabTitle(sessionID)
+}
+
+func (d *dryRunYakuake) SetTabTitle(sessionID int, title string) error {
+	d.plannedTitles[sessionID] = title
+	d.record("setTabTitle(%d, %q)", sessionID, title)
+	return nil
+}
+
+func (d *dryRunYakuake) SessionAtTab(index int) (int, error) {
+	return d.yakuake.SessionAtTab(index)
+}
+
+func (d *dryRunYakuake) ToggleWindowState() error {
+	d.record("toggleWindowState()")
+	return nil
+}
+
+func (d *dryRunYakuake) IsWindowVisible() (bool, error) {
+	return d.yakuake.IsWindowVisible()
+}
@@ -0,0 +1,93 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDryRunLoadSession(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	recorder := newDryRunYakuake(fake)
+	yakuake = recorder
+	configuration := readTestConfig(t, `
+profiles:
+  - name: work
+    clear: true
+    tabs:
+      - name: logs
+        split: lr
+        protected: true
+        commands:
+          - tail -f log
+        terminal2:
+          - htop
+`)
+
+	if err := LoadSession(configuration, "work"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"addSessionTwoHorizontal() = 1000000",
+		`setTabTitle(1000000, "logs")`,
+		`runCommandInTerminal(1000001, "tail -f log")`,
+		`runCommandInTerminal(1000002, "tail -f log")`,
+		`runCommandInTerminal(1000002, "htop")`,
+		"setSessionClosable(1000000, false)",
+		"toggleWindowState()",
+		"removeTerminal(0)",
+	}
+	if !reflect.DeepEqual(recorder.Operations(), expected) {
+		t.Errorf("unexpected operations\n%q\nexpected\n%q", recorder.Operations(), expected)
+	}
+	if sessions := fake.Sessions(); len(sessions) != 1 || fake.WindowVisible() {
+		t.Errorf("yakuake must not be changed in dry run mode, got\n%s", fake)
+	}
+}
+
+func TestDryRunClearAndExecute(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	_, _ = fake.AddSessionTwoVertical()
+	recorder := newDryRunYakuake(fake)
+	yakuake = recorder
+
+	ExecuteCommand("ls", &[]int{1})
+	ClearSession(true)
+
+	expected := []string{
+		`runCommandInTerminal(1, "ls")`,
+		"setSessionClosable(0, true)",
+		"removeTerminal(0)",
+		"setSessionClosable(1, true)",
+		"removeTerminal(1)",
+		"setSessionClosable(1, true)",
+		"removeTerminal(2)",
+	}
+	if !reflect.DeepEqual(recorder.Operations(), expected) {
+		t.Errorf("unexpected operations\n%q\nexpected\n%q", recorder.Operations(), expected)
+	}
+	if len(fake.Sessions()) != 2 || len(fake.Commands(1)) != 0 {
+		t.Errorf("yakuake must not be changed in dry run mode, got\n%s", fake)
+	}
+}
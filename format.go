@@ -0,0 +1,297 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// formats of configuration files, selected by the file extension
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+// the format of a configuration file by its extension, files with other extensions are read as YAML
+func configFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatYAML
+	}
+}
+
+// parseConfigDocument parses a configuration file of any format into the root node of a YAML node tree.
+// The root node is nil for an empty file. TOML files do not keep the position of their values.
+func parseConfigDocument(filename string, buf []byte) (*yaml.Node, error) {
+	switch configFormat(filename) {
+	case FormatJSON:
+		if len(bytes.TrimSpace(buf)) == 0 {
+			return nil, nil
+		}
+		root, err := parseJSONNode(buf)
+		if err != nil {
+			return nil, fmt.Errorf("JSON syntax error in file: %q: %v", filename, err)
+		}
+		return root, nil
+	case FormatTOML:
+		var values map[string]interface{}
+		if _, err := toml.Decode(string(buf), &values); err != nil {
+			return nil, fmt.Errorf("TOML syntax error in file: %q: %v", filename, err)
+		}
+		root := &yaml.Node{}
+		if err := root.Encode(values); err != nil {
+			return nil, err
+		}
+		return root, nil
+	default:
+		var document yaml.Node
+		if err := yaml.Unmarshal(buf, &document); err != nil {
+			return nil, fmt.Errorf("YAML syntax error in file: %q: %v", filename, err)
+		}
+		if len(document.Content) == 0 {
+			return nil, nil
+		}
+		return document.Content[0], nil
+	}
+}
+
+// EncodeConfigNode encodes a node tree of a configuration or a part of it in the given format
+func EncodeConfigNode(node *yaml.Node, format string) ([]byte, error) {
+	switch format {
+	case FormatYAML:
+		return marshalYAML(node)
+	case FormatJSON:
+		var buf bytes.Buffer
+		if err := writeJSONNode(&buf, node, ""); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n")
+		return buf.Bytes(), nil
+	case FormatTOML:
+		if null := findNull(node); null != nil {
+			return nil, fmt.Errorf("line %d: TOML has no empty values, e.g. variables without default value", null.Line)
+		}
+		var values map[string]interface{}
+		if err := node.Decode(&values); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		encoder := toml.NewEncoder(&buf)
+		encoder.Indent = ""
+		if err := encoder.Encode(values); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("invalid format '%s', valid formats: %s, %s, %s", format, FormatYAML, FormatJSON, FormatTOML)
+	}
+}
+
+// ConvertConfigFile returns a configuration file in another format. Includes, templates and inheritance are kept.
+func ConvertConfigFile(filename string, format string) ([]byte, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseConfigDocument(filename, buf)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	return EncodeConfigNode(root, format)
+}
+
+// the first null value of a node tree
+func findNull(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return node
+	}
+	for _, child := range node.Content {
+		if null := findNull(child); null != nil {
+			return null
+		}
+	}
+	return nil
+}
+
+// write a node tree as JSON, keeping the order of keys
+func writeJSONNode(buf *bytes.Buffer, node *yaml.Node, indent string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("null")
+			return nil
+		}
+		return writeJSONNode(buf, node.Content[0], indent)
+	case yaml.AliasNode:
+		return writeJSONNode(buf, node.Alias, indent)
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, end, step := "[", "]", 1
+		if node.Kind == yaml.MappingNode {
+			open, end, step = "{", "}", 2
+		}
+		if len(node.Content) == 0 {
+			buf.WriteString(open + end)
+			return nil
+		}
+		buf.WriteString(open + "\n")
+		for i := 0; i < len(node.Content); i += step {
+			buf.WriteString(indent + "  ")
+			if node.Kind == yaml.MappingNode {
+				if err := writeJSONValue(buf, node.Content[i].Value); err != nil {
+					return err
+				}
+				buf.WriteString(": ")
+			}
+			if err := writeJSONNode(buf, node.Content[i+step-1], indent+"  "); err != nil {
+				return err
+			}
+			if i+step < len(node.Content) {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + end)
+		return nil
+	default:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		return writeJSONValue(buf, value)
+	}
+}
+
+// write a scalar as JSON, without escaping characters like & used in commands
+func writeJSONValue(buf *bytes.Buffer, value interface{}) error {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	buf.Write(bytes.TrimSuffix(encoded.Bytes(), []byte("\n")))
+	return nil
+}
+
+// parseJSONNode parses a JSON document into a node tree, keeping the order and positions of keys and values
+func parseJSONNode(buf []byte) (*yaml.Node, error) {
+	parser := &jsonParser{decoder: json.NewDecoder(bytes.NewReader(buf)), buf: buf}
+	parser.decoder.UseNumber()
+	root, err := parser.value()
+	if err != nil {
+		return nil, parser.positionError(err)
+	}
+	if _, err := parser.decoder.Token(); err == nil {
+		line, column := parser.position()
+		return nil, fmt.Errorf("line %d, column %d: unexpected content after the document", line, column)
+	}
+	return root, nil
+}
+
+type jsonParser struct {
+	decoder *json.Decoder
+	buf     []byte
+}
+
+func (p *jsonParser) value() (*yaml.Node, error) {
+	line, column := p.position()
+	token, err := p.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Line: line, Column: column}
+	switch value := token.(type) {
+	case json.Delim:
+		node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		if value == '{' {
+			node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		}
+		for p.decoder.More() {
+			child, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		if _, err := p.decoder.Token(); err != nil {
+			return nil, err
+		}
+	case string:
+		node.Tag, node.Value = "!!str", value
+	case json.Number:
+		node.Tag, node.Value = "!!int", value.String()
+		if strings.ContainsAny(node.Value, ".eE") {
+			node.Tag = "!!float"
+		}
+	case bool:
+		node.Tag, node.Value = "!!bool", strconv.FormatBool(value)
+	case nil:
+		node.Tag, node.Value = "!!null", "null"
+	}
+	return node, nil
+}
+
+// line and column of the next token
+func (p *jsonParser) position() (int, int) {
+	offset := int(p.decoder.InputOffset())
+	for offset < len(p.buf) && strings.ContainsRune(" \t\r\n,:", rune(p.buf[offset])) {
+		offset++
+	}
+	return p.offsetPosition(offset)
+}
+
+func (p *jsonParser) offsetPosition(offset int) (int, int) {
+	line, column := 1, 1
+	if offset > len(p.buf) {
+		offset = len(p.buf)
+	}
+	for _, char := range p.buf[:offset] {
+		column++
+		if char == '\n' {
+			line, column = line+1, 1
+		}
+	}
+	return line, column
+}
+
+// add the position to syntax errors of the JSON decoder
+func (p *jsonParser) positionError(err error) error {
+	if syntaxErr, ok := err.(*json.SyntaxError); ok {
+		line, column := p.offsetPosition(int(syntaxErr.Offset))
+		return fmt.Errorf("line %d, column %d: %v", line, column, err)
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// the example configuration has to stay the same when converted to another format and read again
+func TestConvertConfigFileRoundTrip(t *testing.T) {
+	expected, err := ReadConfig(".yakctl.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{FormatJSON, FormatTOML, FormatYAML} {
+		converted, err := ConvertConfigFile(".yakctl.yml", format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		file := filepath.Join(t.TempDir(), "config."+format)
+		if err := os.WriteFile(file, converted, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		configuration, err := ReadConfig(file)
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", format, err, converted)
+		}
+		if !reflect.DeepEqual(configuration.Profiles, expected.Profiles) {
+			t.Errorf("%s: unexpected profiles\n%+v\nexpected\n%+v", format, *configuration.Profiles, *expected.Profiles)
+		}
+	}
+}
+
+func TestReadConfigJSON(t *testing.T) {
+	content := `{
+  "templates": [{"name": "ssh", "protected": true}],
+  "profiles": [
+    {
+      "name": "work",
+      "tabs": [
+        {"name": "a", "template": "ssh", "commands": ["make && make install"]},
+        {"name": "b", "split": "lr", "terminal2": ["top"]}
+      ]
+    }
+  ]
+}`
+	dir := writeConfigFiles(t, map[string]string{"config.json": content, "invalid.json": strings.Replace(content, `"split"`, `"spilt"`, 1)})
+
+	configuration, err := ReadConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []TabDescription{
+		{Name: "a", Protected: true, Commands: []Command{{Run: "make && make install"}}},
+		{Name: "b", SplitMode: "lr", Terminal2: []Command{{Run: "top"}}},
+	}
+	if work, _ := GetProfile(configuration, "work"); !reflect.DeepEqual(work.Tabs, expected) {
+		t.Errorf("unexpected tabs %+v", work.Tabs)
+	}
+
+	_, err = ReadConfig(filepath.Join(dir, "invalid.json"))
+	if err == nil || !strings.Contains(err.Error(), "invalid.json:8:23: unknown key 'spilt'") {
+		t.Errorf("expected an unknown key error, got %v", err)
+	}
+
+	_, err = parseJSONNode([]byte("{\n  \"profiles\": [\n}"))
+	if err == nil || !strings.Contains(err.Error(), "line 3, column") {
+		t.Errorf("expected a syntax error with position, got %v", err)
+	}
+}
+
+func TestReadConfigTOML(t *testing.T) {
+	content := "include = \"other.yml\"\n\n[[profiles]]\nname = \"work\"\nclear = true\n\n[[profiles.tabs]]\nname = \"a\"\ncommands = [\"ls\"]\n"
+	dir := writeConfigFiles(t, map[string]string{"config.toml": content, "other.yml": "profiles:\n  - name: home\n"})
+
+	configuration, err := ReadConfig(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ProfileDescription{
+		{Name: "work", ClearAll: true, Tabs: []TabDescription{{Name: "a", Commands: []Command{{Run: "ls"}}}}},
+		{Name: "home"},
+	}
+	if !reflect.DeepEqual(*configuration.Profiles, expected) {
+		t.Errorf("unexpected profiles %+v", *configuration.Profiles)
+	}
+}
+
+func TestConvertConfigFileTOMLWithoutDefault(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{"config.yml": "profiles:\n  - name: web\n    vars:\n      host:\n"})
+	_, err := ConvertConfigFile(filepath.Join(dir, "config.yml"), FormatTOML)
+	if err == nil || !strings.Contains(err.Error(), "line 4: TOML has no empty values") {
+		t.Errorf("expected an error, got %v", err)
+	}
+}
+
+func TestPrintProfileFormats(t *testing.T) {
+	configuration := readTestConfig(t, "profiles:\n  - name: work\n    tabs:\n      - name: a\n        commands:\n          - ls\n")
+	for format, expected := range map[string]string{
+		FormatYAML: "name: work\ntabs:\n  - name: a\n    commands:\n      - ls\n",
+		FormatJSON: "{\n  \"name\": \"work\",\n  \"tabs\": [\n    {\n      \"name\": \"a\",\n      \"commands\": [\n        \"ls\"\n      ]\n    }\n  ]\n}\n",
+		FormatTOML: "name = \"work\"\n\n[[tabs]]\ncommands = [\"ls\"]\nname = \"a\"\n",
+	} {
+		buf := captureOutput(t)
+		if err := PrintProfile(configuration, "work", format); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), strings.TrimSpace(expected)) {
+			t.Errorf("%s: unexpected output\n%s", format, buf.String())
+		}
+	}
+	if err := PrintProfile(configuration, "work", "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
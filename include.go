@@ -0,0 +1,252 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configLoader reads a configuration file and all files it includes
+type configLoader struct {
+	sources   sourceMap
+	files     []ConfigSource
+	loaded    map[string]bool
+	overrides []string
+}
+
+func newConfigLoader() *configLoader {
+	return &configLoader{sources: sourceMap{}, loaded: map[string]bool{}}
+}
+
+// load reads a configuration file and appends the profiles and templates of its includes to its own.
+// Files already loaded are skipped, so includes may overlap or refer back to the including file.
+func (l *configLoader) load(filename string, origin string, includedBy string) (*yaml.Node, error) {
+	absolute, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	l.loaded[absolute] = true
+
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseConfigDocument(filename, buf)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1, Column: 1}
+	}
+	l.sources.add(root, filename)
+	resolveWorkdirs(root, filepath.Dir(filename))
+	l.files = append(l.files, ConfigSource{File: filename, Origin: origin, IncludedBy: includedBy})
+
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: the configuration has to be a mapping with the key 'profiles'", l.sources.position(root))
+	}
+
+	includeNode := mappingValue(root, "include")
+	if includeNode == nil {
+		return root, nil
+	}
+	removeMappingKey(root, "include")
+	includes, err := l.includedFiles(filename, includeNode)
+	if err != nil {
+		return nil, err
+	}
+	for _, include := range includes {
+		absoluteInclude, err := filepath.Abs(include)
+		if err != nil {
+			return nil, err
+		}
+		if l.loaded[absoluteInclude] {
+			continue
+		}
+		included, err := l.load(include, ConfigOriginInclude, filename)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range []string{"profiles", "templates"} {
+			if err := l.appendSequence(root, included, key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return root, nil
+}
+
+// resolve the relative working directories of a file against its directory, like includes. Working directories
+// containing variables are resolved after rendering, see profileDirectories.
+func resolveWorkdirs(node *yaml.Node, dir string) {
+	for i := 0; node.Kind == yaml.MappingNode && i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		if key == "workdir" && value.Kind == yaml.ScalarNode {
+			value.Value = resolveWorkdir(value.Value, dir)
+		}
+	}
+	for i, child := range node.Content {
+		// names of environment variables are no keys of the configuration
+		if node.Kind == yaml.MappingNode && i%2 == 1 && node.Content[i-1].Value == "env" {
+			continue
+		}
+		resolveWorkdirs(child, dir)
+	}
+}
+
+// a working directory relative to dir, unless it is absolute or contains variables
+func resolveWorkdir(workdir string, dir string) string {
+	if len(workdir) == 0 || len(dir) == 0 || strings.Contains(workdir, "{{") || filepath.IsAbs(expandValue(workdir)) {
+		return workdir
+	}
+	return filepath.Join(dir, workdir)
+}
+
+// the directories of the files the profiles are defined in by profile name, the working directories containing
+// variables are resolved against them after rendering
+func profileDirectories(root *yaml.Node, sources sourceMap) map[string]string {
+	dirs := map[string]string{}
+	if profiles := mappingValue(root, "profiles"); profiles != nil {
+		for _, profile := range profiles.Content {
+			if name := mappingValue(profile, "name"); name != nil && len(sources[profile]) > 0 {
+				dirs[name.Value] = filepath.Dir(sources[profile])
+			}
+		}
+	}
+	return dirs
+}
+
+// the files an include directive refers to, relative paths are relative to the including file
+func (l *configLoader) includedFiles(filename string, includeNode *yaml.Node) ([]string, error) {
+	var patterns []*yaml.Node
+	switch includeNode.Kind {
+	case yaml.ScalarNode:
+		patterns = []*yaml.Node{includeNode}
+	case yaml.SequenceNode:
+		patterns = includeNode.Content
+	default:
+		return nil, fmt.Errorf("%s: 'include' has to be a file name or a list of file names", l.sources.position(includeNode))
+	}
+
+	var files []string
+	for _, patternNode := range patterns {
+		if patternNode.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("%s: invalid file name in 'include'", l.sources.position(patternNode))
+		}
+		pattern, err := expandPath(patternNode.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", l.sources.position(patternNode), err)
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(filename), pattern)
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			if _, err := os.Stat(pattern); err != nil {
+				return nil, fmt.Errorf("%s: included file '%s' can't be read: %v", l.sources.position(patternNode), pattern, err)
+			}
+			files = append(files, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern '%s': %v", l.sources.position(patternNode), pattern, err)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// add the profiles and templates of a less specific configuration to a more specific one.
+// Entries of the less specific configuration are dropped if the more specific one has an entry of the same name.
+func (l *configLoader) layer(root *yaml.Node, lower *yaml.Node) error {
+	for _, key := range []string{"profiles", "templates"} {
+		items := mappingValue(lower, key)
+		if items == nil || items.Kind != yaml.SequenceNode {
+			continue
+		}
+		names := map[string]*yaml.Node{}
+		if existing := mappingValue(root, key); existing != nil {
+			for _, item := range existing.Content {
+				if nameNode := mappingValue(item, "name"); nameNode != nil {
+					names[nameNode.Value] = nameNode
+				}
+			}
+		}
+		var kept []*yaml.Node
+		for _, item := range items.Content {
+			nameNode := mappingValue(item, "name")
+			if nameNode != nil && names[nameNode.Value] != nil {
+				l.overrides = append(l.overrides, fmt.Sprintf("%s '%s' at %s replaces the one at %s",
+					strings.TrimSuffix(key, "s"), nameNode.Value, l.sources.position(names[nameNode.Value]), l.sources.position(nameNode)))
+				continue
+			}
+			kept = append(kept, item)
+		}
+		items.Content = kept
+	}
+	for _, key := range []string{"profiles", "templates"} {
+		if err := l.appendSequence(root, lower, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// append the items of a list of the included file to the same list of the including file
+func (l *configLoader) appendSequence(root *yaml.Node, included *yaml.Node, key string) error {
+	items := mappingValue(included, key)
+	if items == nil {
+		return nil
+	}
+	if items.Kind != yaml.SequenceNode {
+		return fmt.Errorf("%s: '%s' has to be a list", l.sources.position(items), key)
+	}
+	target := mappingValue(root, key)
+	if target == nil {
+		target = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: items.Line, Column: items.Column}
+		l.sources[target] = l.sources[items]
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+		setMappingValue(root, keyNode, target)
+	}
+	if target.Kind != yaml.SequenceNode {
+		return fmt.Errorf("%s: '%s' has to be a list", l.sources.position(target), key)
+	}
+	target.Content = append(target.Content, items.Content...)
+	return nil
+}
+
+// expand a leading ~ and environment variables of a path
+func expandPath(path string) (string, error) {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return path, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// write files relative to a temporary directory and return the directory
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadConfigIncludes(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		".yakctl.yml":  "include:\n  - conf.d/*.yml\n  - shared.yml\nprofiles:\n  - name: main\n    tabs:\n      - template: ssh\n",
+		"conf.d/b.yml": "profiles:\n  - name: b\n",
+		"conf.d/a.yml": "include: ../shared.yml\nprofiles:\n  - name: a\n    extends: main\n",
+		"shared.yml":   "templates:\n  - name: ssh\n    commands:\n      - ssh pi\n",
+	})
+
+	configuration, err := ReadConfig(filepath.Join(dir, ".yakctl.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, profile := range *configuration.Profiles {
+		names = append(names, profile.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"main", "a", "b"}) {
+		t.Errorf("unexpected profiles %v", names)
+	}
+	a, _ := GetProfile(configuration, "a")
+	if len(a.Tabs) != 1 || !reflect.DeepEqual(a.Tabs[0].Commands, []Command{{Run: "ssh pi"}}) {
+		t.Errorf("unexpected tabs of included profile %+v", a.Tabs)
+	}
+	if len(configuration.Sources) != 4 || configuration.Sources[3].IncludedBy != configuration.Sources[0].File {
+		t.Errorf("expected 4 files to be read, got %+v", configuration.Sources)
+	}
+}
+
+func TestReadConfigIncludeErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		files map[string]string
+		err   string
+	}{
+		{
+			files: map[string]string{
+				".yakctl.yml": "include: other.yml\nprofiles:\n  - name: work\n",
+				"other.yml":   "profiles:\n  - name: home\n  - name: work\n",
+			},
+			err: "other.yml:3:11: profile 'work' is already defined at ",
+		},
+		{
+			files: map[string]string{".yakctl.yml": "include:\n  - missing.yml\nprofiles: []\n"},
+			err:   ".yakctl.yml:2:5: included file",
+		},
+		{
+			files: map[string]string{
+				".yakctl.yml": "include: other.yml\nprofiles: []\n",
+				"other.yml":   "profiles:\n  - name: a\n    tabs:\n      - template: missing\n",
+			},
+			err: "other.yml:4:19: unknown template 'missing'",
+		},
+	} {
+		dir := writeConfigFiles(t, testCase.files)
+		_, err := ReadConfig(filepath.Join(dir, ".yakctl.yml"))
+		if err == nil || !strings.Contains(err.Error(), testCase.err) {
+			t.Errorf("expected error '%s', got %v", testCase.err, err)
+		}
+	}
+}
+
+func TestReadConfigIncludeCycle(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		".yakctl.yml": "include: '*.yml'\nprofiles:\n  - name: a\n",
+		"b.yml":       "include: .yakctl.yml\nprofiles:\n  - name: b\n",
+	})
+	configuration, err := ReadConfig(filepath.Join(dir, ".yakctl.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*configuration.Profiles) != 2 {
+		t.Errorf("expected each file to be read once, got %+v", *configuration.Profiles)
+	}
+}
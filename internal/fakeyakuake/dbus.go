@@ -0,0 +1,343 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package fakeyakuake
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ServiceName is the well-known name yakuake owns on the session bus
+const ServiceName = "org.kde.yakuake"
+
+const (
+	yakuakeInterface    = "org.kde.yakuake"
+	propertiesInterface = "org.freedesktop.DBus.Properties"
+	widgetInterface     = "org.qtproject.Qt.QWidget"
+	mainWindowPath      = "/yakuake/MainWindow_1"
+	konsoleInterface    = "org.kde.konsole.Session"
+	konsoleSessionsPath = "/Sessions"
+)
+
+// Serve exports the instance on conn and claims the yakuake service name
+func (y *Yakuake) Serve(conn *dbus.Conn) error {
+	if err := y.Export(conn); err != nil {
+		return err
+	}
+	reply, err := conn.RequestName(ServiceName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("name '%s' is already taken on this bus", ServiceName)
+	}
+	return nil
+}
+
+// Export makes the instance available at the object paths and with the methods of yakuake on conn
+func (y *Yakuake) Export(conn *dbus.Conn) error {
+	for path, methods := range y.methodTables() {
+		if err := conn.ExportMethodTable(methods, dbus.ObjectPath(path), yakuakeInterface); err != nil {
+			return err
+		}
+		node := &introspect.Node{
+			Name: path,
+			Interfaces: []introspect.Interface{
+				introspect.IntrospectData,
+				{Name: yakuakeInterface, Methods: introspectMethods(methods)},
+			},
+		}
+		if err := conn.Export(introspect.NewIntrospectable(node), dbus.ObjectPath(path), "org.freedesktop.DBus.Introspectable"); err != nil {
+			return err
+		}
+	}
+
+	// the window state is a property of the main window widget
+	properties := map[string]interface{}{
+		"Get": func(iface string, name string) (dbus.Variant, *dbus.Error) {
+			if iface != widgetInterface || name != "visible" {
+				return dbus.Variant{}, unknownProperty(iface, name)
+			}
+			return dbus.MakeVariant(y.WindowVisible()), nil
+		},
+		"GetAll": func(iface string) (map[string]dbus.Variant, *dbus.Error) {
+			if iface != widgetInterface {
+				return nil, unknownProperty(iface, "")
+			}
+			return map[string]dbus.Variant{"visible": dbus.MakeVariant(y.WindowVisible())}, nil
+		},
+	}
+	if err := conn.ExportMethodTable(properties, mainWindowPath, propertiesInterface); err != nil {
+		return err
+	}
+	if err := y.exportKonsoleSessions(conn); err != nil {
+		return err
+	}
+	node := &introspect.Node{
+		Name: mainWindowPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			{Name: propertiesInterface, Methods: introspectMethods(properties)},
+			{Name: widgetInterface, Properties: []introspect.Property{{Name: "visible", Type: "b", Access: "read"}}},
+		},
+	}
+	return conn.Export(introspect.NewIntrospectable(node), mainWindowPath, "org.freedesktop.DBus.Introspectable")
+}
+
+// the methods of yakuake per object path, named and typed like the original
+func (y *Yakuake) methodTables() map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{
+		"/yakuake/sessions": {
+			"addSession": func() (int32, *dbus.Error) {
+				id, err := y.AddSession()
+				return int32(id), failed(err)
+			},
+			"addSessionTwoHorizontal": func() (int32, *dbus.Error) {
+				id, err := y.AddSessionTwoHorizontal()
+				return int32(id), failed(err)
+			},
+			"addSessionTwoVertical": func() (int32, *dbus.Error) {
+				id, err := y.AddSessionTwoVertical()
+				return int32(id), failed(err)
+			},
+			"addSessionQuad": func() (int32, *dbus.Error) {
+				id, err := y.AddSessionQuad()
+				return int32(id), failed(err)
+			},
+			"activeSessionId": func() (int32, *dbus.Error) {
+				id, err := y.ActiveSessionID()
+				return int32(id), failed(err)
+			},
+			"activeTerminalId": func() (int32, *dbus.Error) {
+				id, err := y.ActiveTerminalID()
+				return int32(id), failed(err)
+			},
+			"sessionIdList": func() (string, *dbus.Error) {
+				ids, err := y.SessionIDs()
+				return joinIDs(ids), failed(err)
+			},
+			"isSessionClosable": func(sessionID int32) (bool, *dbus.Error) {
+				closable, err := y.IsSessionClosable(int(sessionID))
+				return closable, failed(err)
+			},
+			"setSessionClosable": func(sessionID int32, closable bool) *dbus.Error {
+				return failed(y.SetSessionClosable(int(sessionID), closable))
+			},
+			"setSessionMonitorSilenceEnabled": func(sessionID int32, enabled bool) *dbus.Error {
+				return failed(y.SetSessionMonitorSilenceEnabled(int(sessionID), enabled))
+			},
+			"setSessionMonitorActivityEnabled": func(sessionID int32, enabled bool) *dbus.Error {
+				return failed(y.SetSessionMonitorActivityEnabled(int(sessionID), enabled))
+			},
+			"setSessionKeyboardInputEnabled": func(sessionID int32, enabled bool) *dbus.Error {
+				return failed(y.SetSessionKeyboardInputEnabled(int(sessionID), enabled))
+			},
+			"isSessionMonitorSilenceEnabled": func(sessionID int32) (bool, *dbus.Error) {
+				enabled, err := y.IsSessionMonitorSilenceEnabled(int(sessionID))
+				return enabled, failed(err)
+			},
+			"isSessionMonitorActivityEnabled": func(sessionID int32) (bool, *dbus.Error) {
+				enabled, err := y.IsSessionMonitorActivityEnabled(int(sessionID))
+				return enabled, failed(err)
+			},
+			"isSessionKeyboardInputEnabled": func(sessionID int32) (bool, *dbus.Error) {
+				enabled, err := y.IsSessionKeyboardInputEnabled(int(sessionID))
+				return enabled, failed(err)
+			},
+			"terminalIdList": func() (string, *dbus.Error) {
+				ids, err := y.TerminalIDs()
+				return joinIDs(ids), failed(err)
+			},
+			"terminalIdsForSessionId": func(sessionID int32) (string, *dbus.Error) {
+				ids, err := y.TerminalIDsForSessionID(int(sessionID))
+				return joinIDs(ids), failed(err)
+			},
+			"sessionIdForTerminalId": func(terminalID int32) (int32, *dbus.Error) {
+				id, err := y.SessionIDForTerminalID(int(terminalID))
+				return int32(id), failed(err)
+			},
+			"runCommandInTerminal": func(terminalID int32, command string) *dbus.Error {
+				return failed(y.RunCommandInTerminal(int(terminalID), command))
+			},
+			"removeTerminal": func(terminalID int32) *dbus.Error {
+				return failed(y.RemoveTerminal(int(terminalID)))
+			},
+			"setTerminalKeyboardInputEnabled": func(terminalID int32, enabled bool) *dbus.Error {
+				return failed(y.SetTerminalKeyboardInputEnabled(int(terminalID), enabled))
+			},
+			"isTerminalKeyboardInputEnabled": func(terminalID int32) (bool, *dbus.Error) {
+				enabled, err := y.IsTerminalKeyboardInputEnabled(int(terminalID))
+				return enabled, failed(err)
+			},
+			"splitTerminalLeftRight": func(terminalID int32) (int32, *dbus.Error) {
+				id, err := y.SplitTerminalLeftRight(int(terminalID))
+				return int32(id), failed(err)
+			},
+			"splitTerminalTopBottom": func(terminalID int32) (int32, *dbus.Error) {
+				id, err := y.SplitTerminalTopBottom(int(terminalID))
+				return int32(id), failed(err)
+			},
+		},
+		"/yakuake/tabs": {
+			"tabTitle": func(sessionID int32) (string, *dbus.Error) {
+				title, err := y.TabTitle(int(sessionID))
+				return title, failed(err)
+			},
+			"setTabTitle": func(sessionID int32, title string) *dbus.Error {
+				return failed(y.SetTabTitle(int(sessionID), title))
+			},
+			"sessionAtTab": func(index int32) (int32, *dbus.Error) {
+				id, err := y.SessionAtTab(int(index))
+				return int32(id), failed(err)
+			},
+		},
+		"/yakuake/window": {
+			"toggleWindowState": func() *dbus.Error {
+				return failed(y.ToggleWindowState())
+			},
+		},
+	}
+}
+
+// the konsole sessions of the terminals are exported below /Sessions, numbered like konsole does it
+func (y *Yakuake) exportKonsoleSessions(conn *dbus.Conn) error {
+	methods := map[string]interface{}{
+		"processId": func(msg dbus.Message) (int32, *dbus.Error) {
+			terminalID, err := y.konsoleTerminal(msg)
+			if err != nil || terminalID < 0 {
+				return 0, err
+			}
+			pid, pidErr := y.TerminalShellPID(terminalID)
+			return int32(pid), failed(pidErr)
+		},
+		"foregroundProcessId": func(msg dbus.Message) (int32, *dbus.Error) {
+			terminalID, err := y.konsoleTerminal(msg)
+			if err != nil || terminalID < 0 {
+				return 0, err
+			}
+			pid, _, pidErr := y.TerminalForegroundProcess(terminalID)
+			return int32(pid), failed(pidErr)
+		},
+		"getAllDisplayedText": func(msg dbus.Message, preserveLineBreaks bool) (string, *dbus.Error) {
+			terminalID, err := y.konsoleTerminal(msg)
+			if err != nil || terminalID < 0 {
+				return "", err
+			}
+			text, textErr := y.TerminalText(terminalID)
+			return text, failed(textErr)
+		},
+		"sendText": func(msg dbus.Message, text string) *dbus.Error {
+			terminalID, err := y.konsoleTerminal(msg)
+			if err != nil || terminalID < 0 {
+				return err
+			}
+			return failed(y.SendTextToTerminal(terminalID, text))
+		},
+	}
+	if err := conn.ExportSubtreeMethodTable(methods, konsoleSessionsPath, konsoleInterface); err != nil {
+		return err
+	}
+	// the child nodes change with the open sessions, so the introspection is created on each call
+	introspectable := map[string]interface{}{
+		"Introspect": func() (string, *dbus.Error) {
+			node := &introspect.Node{
+				Name:       konsoleSessionsPath,
+				Interfaces: []introspect.Interface{introspect.IntrospectData},
+			}
+			for _, id := range y.konsoleSessionIDs() {
+				node.Children = append(node.Children, introspect.Node{Name: strconv.Itoa(id)})
+			}
+			data, err := xml.Marshal(node)
+			if err != nil {
+				return "", failed(err)
+			}
+			return introspect.IntrospectDeclarationString + string(data), nil
+		},
+	}
+	return conn.ExportMethodTable(introspectable, konsoleSessionsPath, "org.freedesktop.DBus.Introspectable")
+}
+
+// the terminal of the konsole session a call is made on
+func (y *Yakuake) konsoleTerminal(msg dbus.Message) (int, *dbus.Error) {
+	path, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+	id, err := strconv.Atoi(strings.TrimPrefix(string(path), konsoleSessionsPath+"/"))
+	if err != nil {
+		return 0, failed(fmt.Errorf("no konsole session at '%s'", path))
+	}
+	terminalID, err := y.terminalOfKonsoleSession(id)
+	return terminalID, failed(err)
+}
+
+// describe the methods of a method table for introspection, which is required by qdbus
+func introspectMethods(methods map[string]interface{}) []introspect.Method {
+	var result []introspect.Method
+	for name, method := range methods {
+		methodType := reflect.TypeOf(method)
+		m := introspect.Method{Name: name}
+		for i := 0; i < methodType.NumIn(); i++ {
+			m.Args = append(m.Args, introspect.Arg{
+				Name:      "arg" + strconv.Itoa(i),
+				Type:      dbus.SignatureOfType(methodType.In(i)).String(),
+				Direction: "in",
+			})
+		}
+		// the last return value is the error
+		for i := 0; i < methodType.NumOut()-1; i++ {
+			m.Args = append(m.Args, introspect.Arg{
+				Type:      dbus.SignatureOfType(methodType.Out(i)).String(),
+				Direction: "out",
+			})
+		}
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// yakuake returns ids as comma separated string
+func joinIDs(ids []int) string {
+	var parts []string
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return strings.Join(parts, ",")
+}
+
+func failed(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+	return dbus.MakeFailedError(err)
+}
+
+func unknownProperty(iface string, name string) *dbus.Error {
+	return &dbus.Error{
+		Name: "org.freedesktop.DBus.Error.UnknownProperty",
+		Body: []interface{}{fmt.Sprintf("unknown property '%s' of interface '%s'", name, iface)},
+	}
+}
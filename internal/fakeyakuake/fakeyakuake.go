@@ -0,0 +1,818 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package fakeyakuake provides an in-process simulation of a yakuake instance.
+// It offers the same operations yakctl performs via D-Bus and is used to test yakctl without a KDE desktop.
+package fakeyakuake
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Session is the state of a single yakuake session (= tab)
+type Session struct {
+	ID                   int
+	Title                string
+	Terminals            []int
+	Closable             bool
+	MonitorSilence       bool
+	MonitorActivity      bool
+	KeyboardInputEnabled bool
+	// splits of terminals of the session in the order they were performed
+	Splits []Split
+}
+
+// Split is the split of a terminal into the terminal and a new one, in direction "lr" or "tb"
+type Split struct {
+	TerminalID    int
+	NewTerminalID int
+	Direction     string
+}
+
+// Yakuake is a simulated yakuake instance, safe for concurrent use
+type Yakuake struct {
+	mu              sync.Mutex
+	sessions        []*Session
+	nextSessionID   int
+	nextTerminalID  int
+	activeSessionID int
+	// the terminal having the focus by session
+	focused       map[int]int
+	windowVisible bool
+	commands      map[int][]string
+	directories   map[int]string
+	inputDisabled map[int]bool
+	errors        map[string]error
+	// processes of the terminals
+	nextPID        int
+	shells         map[int]int
+	foreground     map[int]process
+	startup        map[int]int
+	startupQueries int
+	programs       map[string]bool
+	// displayed text and typed text of the terminals
+	screens   map[int]string
+	sentText  map[int][]string
+	responses map[string][]string
+	// the terminal of each konsole session, -1 for sessions outside of yakuake
+	konsoleSessions    map[int]int
+	nextKonsoleSession int
+}
+
+type process struct {
+	pid  int
+	name string
+}
+
+// New creates a simulated yakuake instance without any session and with a hidden window
+func New() *Yakuake {
+	return &Yakuake{
+		activeSessionID: -1,
+		focused:         map[int]int{},
+		commands:        map[int][]string{},
+		directories:     map[int]string{},
+		inputDisabled:   map[int]bool{},
+		errors:          map[string]error{},
+		nextPID:         1000,
+		shells:          map[int]int{},
+		foreground:      map[int]process{},
+		startup:         map[int]int{},
+		programs:        map[string]bool{},
+		screens:         map[int]string{},
+		sentText:        map[int][]string{},
+		responses:       map[string][]string{},
+		konsoleSessions: map[int]int{},
+		// konsole numbers its sessions starting at 1
+		nextKonsoleSession: 1,
+	}
+}
+
+// SetError lets all following calls of the given method (e.g. "AddSession") fail with err, nil resets it
+func (y *Yakuake) SetError(method string, err error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err == nil {
+		delete(y.errors, method)
+		return
+	}
+	y.errors[method] = err
+}
+
+// Sessions returns a copy of all sessions in tab order
+func (y *Yakuake) Sessions() []Session {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	var sessions []Session
+	for _, session := range y.sessions {
+		sessions = append(sessions, copySession(session))
+	}
+	return sessions
+}
+
+// Session returns a copy of the session with the given id
+func (y *Yakuake) Session(sessionID int) (Session, bool) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	session := y.session(sessionID)
+	if session == nil {
+		return Session{}, false
+	}
+	return copySession(session), true
+}
+
+// Commands returns all commands run in the given terminal so far
+func (y *Yakuake) Commands(terminalID int) []string {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	return append([]string(nil), y.commands[terminalID]...)
+}
+
+// SetWorkingDirectory sets the directory the shell of a terminal is in
+func (y *Yakuake) SetWorkingDirectory(terminalID int, directory string) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.directories[terminalID] = directory
+}
+
+// SentText returns all text typed into the given terminal by SendTextToTerminal so far
+func (y *Yakuake) SentText(terminalID int) []string {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	return append([]string(nil), y.sentText[terminalID]...)
+}
+
+// Respond lets the terminal display the next of the outputs each time the input is run or typed into a terminal
+func (y *Yakuake) Respond(input string, outputs ...string) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.responses[input] = append(y.responses[input], outputs...)
+}
+
+// SetShellStartup lets the shells of new terminals start only after the given number of TerminalShellPID calls.
+// Commands run in a terminal before its shell is started are lost.
+func (y *Yakuake) SetShellStartup(queries int) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.startupQueries = queries
+}
+
+// AddKonsoleSession adds a konsole session without a terminal of yakuake, like the ones of other konsole parts in
+// the same process, and returns its id
+func (y *Yakuake) AddKonsoleSession() int {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	id := y.nextKonsoleSession
+	y.nextKonsoleSession++
+	y.konsoleSessions[id] = -1
+	return id
+}
+
+// RemoveKonsoleSession closes a konsole session added by AddKonsoleSession
+func (y *Yakuake) RemoveKonsoleSession(id int) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if y.konsoleSessions[id] == -1 {
+		delete(y.konsoleSessions, id)
+	}
+}
+
+// KeepRunning lets commands starting with the given program, e.g. ssh, keep it in the foreground of their terminal
+func (y *Yakuake) KeepRunning(program string) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.programs[program] = true
+}
+
+// WindowVisible reports if the simulated window is shown
+func (y *Yakuake) WindowVisible() bool {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	return y.windowVisible
+}
+
+// SetWindowVisible shows or hides the simulated window
+func (y *Yakuake) SetWindowVisible(visible bool) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.windowVisible = visible
+}
+
+// SetActiveTerminal focuses a terminal and makes its session the active one
+func (y *Yakuake) SetActiveTerminal(terminalID int) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if session, _ := y.sessionOfTerminal(terminalID); session != nil {
+		y.activeSessionID = session.ID
+		y.focused[session.ID] = terminalID
+	}
+}
+
+// MoveTab moves the tab of a session to the given position, like dragging it in yakuake
+func (y *Yakuake) MoveTab(sessionID int, index int) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	for i, session := range y.sessions {
+		if session.ID != sessionID {
+			continue
+		}
+		y.sessions = append(y.sessions[:i], y.sessions[i+1:]...)
+		y.sessions = append(y.sessions[:index], append([]*Session{session}, y.sessions[index:]...)...)
+		return
+	}
+}
+
+// SetActiveSession makes the given session the active one
+func (y *Yakuake) SetActiveSession(sessionID int) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.activeSessionID = sessionID
+}
+
+// Ping is always successful unless an error is set
+func (y *Yakuake) Ping() error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	return y.errors["Ping"]
+}
+
+// Close does nothing
+func (y *Yakuake) Close() error {
+	return nil
+}
+
+// Simulated is false, the operations change the simulated instance like they change yakuake
+func (y *Yakuake) Simulated() bool {
+	return false
+}
+
+// AddSession opens a new tab with one terminal
+func (y *Yakuake) AddSession() (int, error) {
+	return y.addSession("AddSession", 1)
+}
+
+// AddSessionTwoHorizontal opens a new tab with two terminals side by side
+func (y *Yakuake) AddSessionTwoHorizontal() (int, error) {
+	return y.addSession("AddSessionTwoHorizontal", 2)
+}
+
+// AddSessionTwoVertical opens a new tab with two terminals on top of each other
+func (y *Yakuake) AddSessionTwoVertical() (int, error) {
+	return y.addSession("AddSessionTwoVertical", 2)
+}
+
+// AddSessionQuad opens a new tab with four terminals
+func (y *Yakuake) AddSessionQuad() (int, error) {
+	return y.addSession("AddSessionQuad", 4)
+}
+
+// ActiveSessionID returns the id of the active session or -1
+func (y *Yakuake) ActiveSessionID() (int, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["ActiveSessionID"]; err != nil {
+		return 0, err
+	}
+	return y.activeSessionID, nil
+}
+
+// ActiveTerminalID returns the focused terminal of the active session, -1 if there is no active session
+func (y *Yakuake) ActiveTerminalID() (int, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["ActiveTerminalID"]; err != nil {
+		return 0, err
+	}
+	session := y.session(y.activeSessionID)
+	if session == nil || len(session.Terminals) == 0 {
+		return -1, nil
+	}
+	focused, ok := y.focused[session.ID]
+	if owner, _ := y.sessionOfTerminal(focused); !ok || owner != session {
+		return session.Terminals[0], nil
+	}
+	return focused, nil
+}
+
+// SessionIDs returns the ids of all sessions
+func (y *Yakuake) SessionIDs() ([]int, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["SessionIDs"]; err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, session := range y.sessions {
+		ids = append(ids, session.ID)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// IsSessionClosable returns false for unknown sessions, like yakuake does
+func (y *Yakuake) IsSessionClosable(sessionID int) (bool, error) {
+	return y.readSession("IsSessionClosable", sessionID, func(session *Session) bool {
+		return session.Closable
+	})
+}
+
+// SetSessionClosable protects or unprotects a session
+func (y *Yakuake) SetSessionClosable(sessionID int, closable bool) error {
+	return y.updateSession("SetSessionClosable", sessionID, func(session *Session) {
+		session.Closable = closable
+	})
+}
+
+// SetSessionMonitorSilenceEnabled toggles silence monitoring of a session
+func (y *Yakuake) SetSessionMonitorSilenceEnabled(sessionID int, enabled bool) error {
+	return y.updateSession("SetSessionMonitorSilenceEnabled", sessionID, func(session *Session) {
+		session.MonitorSilence = enabled
+	})
+}
+
+// SetSessionMonitorActivityEnabled toggles activity monitoring of a session
+func (y *Yakuake) SetSessionMonitorActivityEnabled(sessionID int, enabled bool) error {
+	return y.updateSession("SetSessionMonitorActivityEnabled", sessionID, func(session *Session) {
+		session.MonitorActivity = enabled
+	})
+}
+
+// SetSessionKeyboardInputEnabled toggles keyboard input of a session
+func (y *Yakuake) SetSessionKeyboardInputEnabled(sessionID int, enabled bool) error {
+	return y.updateSession("SetSessionKeyboardInputEnabled", sessionID, func(session *Session) {
+		session.KeyboardInputEnabled = enabled
+	})
+}
+
+// IsSessionMonitorSilenceEnabled returns false for unknown sessions
+func (y *Yakuake) IsSessionMonitorSilenceEnabled(sessionID int) (bool, error) {
+	return y.readSession("IsSessionMonitorSilenceEnabled", sessionID, func(session *Session) bool {
+		return session.MonitorSilence
+	})
+}
+
+// IsSessionMonitorActivityEnabled returns false for unknown sessions
+func (y *Yakuake) IsSessionMonitorActivityEnabled(sessionID int) (bool, error) {
+	return y.readSession("IsSessionMonitorActivityEnabled", sessionID, func(session *Session) bool {
+		return session.MonitorActivity
+	})
+}
+
+// IsSessionKeyboardInputEnabled returns false for unknown sessions
+func (y *Yakuake) IsSessionKeyboardInputEnabled(sessionID int) (bool, error) {
+	return y.readSession("IsSessionKeyboardInputEnabled", sessionID, func(session *Session) bool {
+		return session.KeyboardInputEnabled
+	})
+}
+
+// TerminalIDs returns the ids of all terminals
+func (y *Yakuake) TerminalIDs() ([]int, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["TerminalIDs"]; err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, session := range y.sessions {
+		ids = append(ids, session.Terminals...)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// TerminalIDsForSessionID returns the terminal ids of a session, empty for unknown sessions
+func (y *Yakuake) TerminalIDsForSessionID(sessionID int) ([]int, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["TerminalIDsForSessionID"]; err != nil {
+		return nil, err
+	}
+	session := y.session(sessionID)
+	if session == nil {
+		return nil, nil
+	}
+	return append([]int(nil), session.Terminals...), nil
+}
+
+// SessionIDForTerminalID returns the session id of a terminal or -1
+func (y *Yakuake) SessionIDForTerminalID(terminalID int) (int, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["SessionIDForTerminalID"]; err != nil {
+		return 0, err
+	}
+	session, _ := y.sessionOfTerminal(terminalID)
+	if session == nil {
+		return -1, nil
+	}
+	return session.ID, nil
+}
+
+// RunCommandInTerminal records the command for the terminal, unknown terminals and terminals without started shell are ignored
+func (y *Yakuake) RunCommandInTerminal(terminalID int, command string) error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["RunCommandInTerminal"]; err != nil {
+		return err
+	}
+	if session, _ := y.sessionOfTerminal(terminalID); session == nil || y.startup[terminalID] > 0 {
+		return nil
+	}
+	y.commands[terminalID] = append(y.commands[terminalID], command)
+	y.display(terminalID, command+"\n")
+	if fields := strings.Fields(command); len(fields) > 0 && y.programs[fields[0]] {
+		y.foreground[terminalID] = process{pid: y.nextPID, name: fields[0]}
+		y.nextPID++
+	}
+	return nil
+}
+
+// RemoveTerminal closes a terminal, sessions without terminals are closed, too.
+// Terminals of protected sessions are not closed.
+func (y *Yakuake) RemoveTerminal(terminalID int) error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["RemoveTerminal"]; err != nil {
+		return err
+	}
+	session, index := y.sessionOfTerminal(terminalID)
+	if session == nil || !session.Closable {
+		return nil
+	}
+	session.Terminals = append(session.Terminals[:index], session.Terminals[index+1:]...)
+	delete(y.commands, terminalID)
+	delete(y.directories, terminalID)
+	delete(y.inputDisabled, terminalID)
+	delete(y.shells, terminalID)
+	delete(y.foreground, terminalID)
+	delete(y.startup, terminalID)
+	delete(y.screens, terminalID)
+	delete(y.sentText, terminalID)
+	for id, terminal := range y.konsoleSessions {
+		if terminal == terminalID {
+			delete(y.konsoleSessions, id)
+		}
+	}
+	if len(session.Terminals) == 0 {
+		y.removeSession(session.ID)
+	}
+	return nil
+}
+
+// SetTerminalKeyboardInputEnabled toggles keyboard input of a single terminal, unknown terminals are ignored
+func (y *Yakuake) SetTerminalKeyboardInputEnabled(terminalID int, enabled bool) error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["SetTerminalKeyboardInputEnabled"]; err != nil {
+		return err
+	}
+	if session, _ := y.sessionOfTerminal(terminalID); session == nil {
+		return nil
+	}
+	if enabled {
+		delete(y.inputDisabled, terminalID)
+	} else {
+		y.inputDisabled[terminalID] = true
+	}
+	return nil
+}
+
+// IsTerminalKeyboardInputEnabled returns false for unknown terminals
+func (y *Yakuake) IsTerminalKeyboardInputEnabled(terminalID int) (bool, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["IsTerminalKeyboardInputEnabled"]; err != nil {
+		return false, err
+	}
+	session, _ := y.sessionOfTerminal(terminalID)
+	return session != nil && !y.inputDisabled[terminalID], nil
+}
+
+// SplitTerminalLeftRight adds a terminal to the session of a terminal and returns its id, -1 for unknown terminals
+func (y *Yakuake) SplitTerminalLeftRight(terminalID int) (int, error) {
+	return y.splitTerminal("SplitTerminalLeftRight", terminalID, "lr")
+}
+
+// SplitTerminalTopBottom adds a terminal to the session of a terminal and returns its id, -1 for unknown terminals
+func (y *Yakuake) SplitTerminalTopBottom(terminalID int) (int, error) {
+	return y.splitTerminal("SplitTerminalTopBottom", terminalID, "tb")
+}
+
+// TerminalWorkingDirectory returns the directory set by SetWorkingDirectory
+func (y *Yakuake) TerminalWorkingDirectory(terminalID int) (string, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["TerminalWorkingDirectory"]; err != nil {
+		return "", err
+	}
+	directory, ok := y.directories[terminalID]
+	if !ok {
+		return "", fmt.Errorf("no working directory known for terminal #%d", terminalID)
+	}
+	return directory, nil
+}
+
+// TerminalShellPID returns the process id of the shell of a terminal, 0 while it is starting
+func (y *Yakuake) TerminalShellPID(terminalID int) (int, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["TerminalShellPID"]; err != nil {
+		return 0, err
+	}
+	pid, ok := y.shells[terminalID]
+	if !ok {
+		return 0, fmt.Errorf("unknown terminal #%d", terminalID)
+	}
+	if y.startup[terminalID] > 0 {
+		y.startup[terminalID]--
+		return 0, nil
+	}
+	return pid, nil
+}
+
+// TerminalForegroundProcess returns the shell of a terminal or the program of the last command kept running
+func (y *Yakuake) TerminalForegroundProcess(terminalID int) (int, string, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["TerminalForegroundProcess"]; err != nil {
+		return 0, "", err
+	}
+	foreground, ok := y.foreground[terminalID]
+	if !ok {
+		return 0, "", fmt.Errorf("unknown terminal #%d", terminalID)
+	}
+	if y.startup[terminalID] > 0 {
+		return 0, "", nil
+	}
+	return foreground.pid, foreground.name, nil
+}
+
+// TerminalText returns everything run or typed in a terminal followed by the responses to it
+func (y *Yakuake) TerminalText(terminalID int) (string, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["TerminalText"]; err != nil {
+		return "", err
+	}
+	if session, _ := y.sessionOfTerminal(terminalID); session == nil {
+		return "", fmt.Errorf("unknown terminal #%d", terminalID)
+	}
+	return y.screens[terminalID], nil
+}
+
+// SendTextToTerminal records the text typed into the terminal, unknown terminals and terminals without started shell are ignored
+func (y *Yakuake) SendTextToTerminal(terminalID int, text string) error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["SendTextToTerminal"]; err != nil {
+		return err
+	}
+	if session, _ := y.sessionOfTerminal(terminalID); session == nil || y.startup[terminalID] > 0 {
+		return nil
+	}
+	y.sentText[terminalID] = append(y.sentText[terminalID], text)
+	y.display(terminalID, text)
+	return nil
+}
+
+// TabTitle returns the title of a session, empty for unknown sessions
+func (y *Yakuake) TabTitle(sessionID int) (string, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["TabTitle"]; err != nil {
+		return "", err
+	}
+	session := y.session(sessionID)
+	if session == nil {
+		return "", nil
+	}
+	return session.Title, nil
+}
+
+// SetTabTitle changes the title of a session
+func (y *Yakuake) SetTabTitle(sessionID int, title string) error {
+	return y.updateSession("SetTabTitle", sessionID, func(session *Session) {
+		session.Title = title
+	})
+}
+
+// SessionAtTab returns the id of the session at a tab position, -1 for positions without tab
+func (y *Yakuake) SessionAtTab(index int) (int, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["SessionAtTab"]; err != nil {
+		return 0, err
+	}
+	if index < 0 || index >= len(y.sessions) {
+		return -1, nil
+	}
+	return y.sessions[index].ID, nil
+}
+
+// ToggleWindowState shows or hides the window
+func (y *Yakuake) ToggleWindowState() error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["ToggleWindowState"]; err != nil {
+		return err
+	}
+	y.windowVisible = !y.windowVisible
+	return nil
+}
+
+// IsWindowVisible reports if the window is shown
+func (y *Yakuake) IsWindowVisible() (bool, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors["IsWindowVisible"]; err != nil {
+		return false, err
+	}
+	return y.windowVisible, nil
+}
+
+// String describes the state of the instance, useful in test failures
+func (y *Yakuake) String() string {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	var lines []string
+	for _, session := range y.sessions {
+		var terminals []string
+		for _, terminalID := range session.Terminals {
+			terminals = append(terminals, strconv.Itoa(terminalID))
+		}
+		lines = append(lines, fmt.Sprintf("session #%d '%s' terminals=[%s] closable=%v silence=%v activity=%v input=%v",
+			session.ID, session.Title, strings.Join(terminals, ","), session.Closable,
+			session.MonitorSilence, session.MonitorActivity, session.KeyboardInputEnabled))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (y *Yakuake) addSession(method string, terminalCount int) (int, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors[method]; err != nil {
+		return 0, err
+	}
+	session := &Session{
+		ID:                   y.nextSessionID,
+		Title:                fmt.Sprintf("Shell No. %d", y.nextSessionID+1),
+		Closable:             true,
+		KeyboardInputEnabled: true,
+	}
+	y.nextSessionID++
+	for i := 0; i < terminalCount; i++ {
+		session.Terminals = append(session.Terminals, y.addTerminal())
+	}
+	y.sessions = append(y.sessions, session)
+	y.activeSessionID = session.ID
+	return session.ID, nil
+}
+
+func (y *Yakuake) splitTerminal(method string, terminalID int, direction string) (int, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors[method]; err != nil {
+		return 0, err
+	}
+	session, _ := y.sessionOfTerminal(terminalID)
+	if session == nil {
+		return -1, nil
+	}
+	newTerminalID := y.addTerminal()
+	session.Terminals = append(session.Terminals, newTerminalID)
+	session.Splits = append(session.Splits, Split{TerminalID: terminalID, NewTerminalID: newTerminalID, Direction: direction})
+	y.focused[session.ID] = newTerminalID
+	return newTerminalID, nil
+}
+
+// show input in a terminal, followed by the next response to it
+func (y *Yakuake) display(terminalID int, input string) {
+	y.screens[terminalID] += input
+	key := strings.TrimSuffix(input, "\n")
+	if outputs := y.responses[key]; len(outputs) > 0 {
+		y.screens[terminalID] += outputs[0]
+		y.responses[key] = outputs[1:]
+	}
+}
+
+// a new terminal with a shell process, which starts after the configured number of queries
+func (y *Yakuake) addTerminal() int {
+	terminalID := y.nextTerminalID
+	y.nextTerminalID++
+	y.shells[terminalID] = y.nextPID
+	y.foreground[terminalID] = process{pid: y.nextPID, name: "bash"}
+	y.nextPID++
+	y.konsoleSessions[y.nextKonsoleSession] = terminalID
+	y.nextKonsoleSession++
+	if y.startupQueries > 0 {
+		y.startup[terminalID] = y.startupQueries
+	}
+	return terminalID
+}
+
+func (y *Yakuake) updateSession(method string, sessionID int, update func(session *Session)) error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors[method]; err != nil {
+		return err
+	}
+	if session := y.session(sessionID); session != nil {
+		update(session)
+	}
+	return nil
+}
+
+func (y *Yakuake) readSession(method string, sessionID int, read func(session *Session) bool) (bool, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if err := y.errors[method]; err != nil {
+		return false, err
+	}
+	session := y.session(sessionID)
+	return session != nil && read(session), nil
+}
+
+// the ids of the open konsole sessions in ascending order
+func (y *Yakuake) konsoleSessionIDs() []int {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	var ids []int
+	for id := range y.konsoleSessions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// the terminal of an open konsole session, -1 for sessions outside of yakuake
+func (y *Yakuake) terminalOfKonsoleSession(id int) (int, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	terminalID, ok := y.konsoleSessions[id]
+	if !ok {
+		return 0, fmt.Errorf("unknown konsole session #%d", id)
+	}
+	return terminalID, nil
+}
+
+func (y *Yakuake) removeSession(sessionID int) {
+	for i, session := range y.sessions {
+		if session.ID != sessionID {
+			continue
+		}
+		y.sessions = append(y.sessions[:i], y.sessions[i+1:]...)
+		if y.activeSessionID == sessionID {
+			y.activeSessionID = -1
+			if len(y.sessions) > 0 {
+				y.activeSessionID = y.sessions[len(y.sessions)-1].ID
+			}
+		}
+		return
+	}
+}
+
+func (y *Yakuake) session(sessionID int) *Session {
+	for _, session := range y.sessions {
+		if session.ID == sessionID {
+			return session
+		}
+	}
+	return nil
+}
+
+func (y *Yakuake) sessionOfTerminal(terminalID int) (*Session, int) {
+	for _, session := range y.sessions {
+		for i, id := range session.Terminals {
+			if id == terminalID {
+				return session, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+func copySession(session *Session) Session {
+	copied := *session
+	copied.Terminals = append([]int(nil), session.Terminals...)
+	copied.Splits = append([]Split(nil), session.Splits...)
+	return copied
+}
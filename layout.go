@@ -0,0 +1,190 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LayoutDescription is a pane of a tab, or a part of a tab split into further panes
+type LayoutDescription struct {
+	// direction the children are split in: lr (side by side) or tb (on top of each other)
+	Split    string              `yaml:"split,omitempty"`
+	Children []LayoutDescription `yaml:"children,omitempty"`
+	// a part without children is a pane
+	PaneDescription `yaml:",inline"`
+	// size relative to the siblings, yakuake splits terminals in halves, so sizes select where a list of panes is halved
+	Size int `yaml:"size,omitempty"`
+}
+
+// the directions of a layout split by their names, case-insensitive
+var layoutSplits = map[string]string{
+	"lr":         "lr",
+	"left-right": "lr",
+	"horizontal": "lr",
+	"tb":         "tb",
+	"top-bottom": "tb",
+	"vertical":   "tb",
+}
+
+// terminalPane is a pane of a tab and the terminal opened for it
+type terminalPane struct {
+	pane       *PaneDescription
+	terminalID int
+}
+
+// paneCount is the number of terminals a layout consists of
+func (l *LayoutDescription) paneCount() int {
+	if len(l.Children) == 0 {
+		return 1
+	}
+	count := 0
+	for i := range l.Children {
+		count += l.Children[i].paneCount()
+	}
+	return count
+}
+
+// effectiveLayout is the layout a tab is opened with: its layout or, if it has more panes than terminals of its split,
+// a layout of the panes in the direction of the split, side by side unless split top-bottom. It is nil for tabs
+// opened with the terminals of their split.
+func (tab *TabDescription) effectiveLayout() *LayoutDescription {
+	if tab.Layout != nil {
+		return tab.Layout
+	}
+	panes := tab.terminalPanes()
+	if len(panes) <= splitModeTerminals[strings.ToLower(tab.SplitMode)] {
+		return nil
+	}
+	layout := &LayoutDescription{Split: "lr"}
+	if direction, exists := layoutSplits[strings.ToLower(tab.SplitMode)]; exists {
+		layout.Split = direction
+	}
+	for _, pane := range panes {
+		layout.Children = append(layout.Children, LayoutDescription{PaneDescription: pane})
+	}
+	return layout
+}
+
+// buildLayout splits a terminal along the layout and returns the panes in the order of the layout
+func buildLayout(layout *LayoutDescription, terminalID int) ([]terminalPane, error) {
+	if len(layout.Children) == 0 {
+		return []terminalPane{{pane: &layout.PaneDescription, terminalID: terminalID}}, nil
+	}
+	return buildSplit(layoutSplits[strings.ToLower(layout.Split)], layout.Children, terminalID)
+}
+
+// split a terminal for a list of panes in the same direction. The list is halved where the sizes of both halves are closest.
+func buildSplit(direction string, children []LayoutDescription, terminalID int) ([]terminalPane, error) {
+	if len(children) == 1 {
+		return buildLayout(&children[0], terminalID)
+	}
+	var newTerminalID int
+	var err error
+	if direction == "tb" {
+		newTerminalID, err = yakuake.SplitTerminalTopBottom(terminalID)
+	} else {
+		newTerminalID, err = yakuake.SplitTerminalLeftRight(terminalID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if newTerminalID < 0 {
+		return nil, fmt.Errorf("terminal #%d can't be split", terminalID)
+	}
+	index := splitIndex(children)
+	first, err := buildSplit(direction, children[:index], terminalID)
+	if err != nil {
+		return first, err
+	}
+	second, err := buildSplit(direction, children[index:], newTerminalID)
+	return append(first, second...), err
+}
+
+// the index halving a list of panes by their sizes. Panes without size get the average size of their siblings.
+func splitIndex(children []LayoutDescription) int {
+	sizes := make([]int, len(children))
+	specified, sum := 0, 0
+	for _, child := range children {
+		if child.Size > 0 {
+			specified++
+			sum += child.Size
+		}
+	}
+	defaultSize := 1
+	if specified > 0 {
+		defaultSize = sum / specified
+	}
+	total := 0
+	for i, child := range children {
+		sizes[i] = child.Size
+		if sizes[i] <= 0 {
+			sizes[i] = defaultSize
+		}
+		total += sizes[i]
+	}
+
+	index, best, prefix := 1, -1, 0
+	for i := 1; i < len(children); i++ {
+		prefix += sizes[i-1]
+		distance := 2*prefix - total
+		if distance < 0 {
+			distance = -distance
+		}
+		if best < 0 || distance < best {
+			index, best = i, distance
+		}
+	}
+	return index
+}
+
+// panesByTerminal lists the panes of a layout in the order their terminals are opened by buildLayout,
+// which is the order of the terminal ids yakuake lists for the session
+func (l *LayoutDescription) panesByTerminal() []PaneDescription {
+	next := 1
+	var leaves []PaneDescription
+	slots := layoutSlots(l, 0, &next, &leaves)
+	panes := make([]PaneDescription, len(slots))
+	for i, slot := range slots {
+		panes[slot] = leaves[i]
+	}
+	return panes
+}
+
+// the position of the terminal of each pane of a layout in the order of the layout, like buildLayout splits them
+func layoutSlots(layout *LayoutDescription, slot int, next *int, leaves *[]PaneDescription) []int {
+	if len(layout.Children) == 0 {
+		*leaves = append(*leaves, layout.PaneDescription)
+		return []int{slot}
+	}
+	return splitSlots(layout.Children, slot, next, leaves)
+}
+
+func splitSlots(children []LayoutDescription, slot int, next *int, leaves *[]PaneDescription) []int {
+	if len(children) == 1 {
+		return layoutSlots(&children[0], slot, next, leaves)
+	}
+	newSlot := *next
+	*next++
+	index := splitIndex(children)
+	first := splitSlots(children[:index], slot, next, leaves)
+	return append(first, splitSlots(children[index:], newSlot, next, leaves)...)
+}
@@ -0,0 +1,230 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"github.com/emschu/yakctl/internal/fakeyakuake"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const layoutTestConfig = `
+profiles:
+  - name: dev
+    tabs:
+      - name: ide
+        commands:
+          - cd ~/src
+        layout:
+          split: lr
+          children:
+            - commands: [vim]
+              size: 2
+            - split: tb
+              children:
+                - commands: [make watch]
+                - commands: [git status]
+            - commands: [htop]
+`
+
+func TestLoadSessionLayout(t *testing.T) {
+	fake := newFakeYakuake(t)
+	configuration := readTestConfig(t, layoutTestConfig)
+	captureOutput(t)
+
+	if err := LoadSession(configuration, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	session := sessionByTitle(t, fake, "ide")
+	// vim gets the left half, the right half is split for the stacked panes and htop
+	expectedSplits := []fakeyakuake.Split{
+		{TerminalID: 1, NewTerminalID: 2, Direction: "lr"},
+		{TerminalID: 2, NewTerminalID: 3, Direction: "lr"},
+		{TerminalID: 2, NewTerminalID: 4, Direction: "tb"},
+	}
+	if !reflect.DeepEqual(session.Splits, expectedSplits) {
+		t.Errorf("unexpected splits %+v", session.Splits)
+	}
+	for terminalID, expected := range map[int][]string{
+		1: {"cd ~/src", "vim"},
+		2: {"cd ~/src", "make watch"},
+		3: {"cd ~/src", "htop"},
+		4: {"cd ~/src", "git status"},
+	} {
+		if commands := fake.Commands(terminalID); !reflect.DeepEqual(commands, expected) {
+			t.Errorf("terminal #%d: unexpected commands %v", terminalID, commands)
+		}
+	}
+}
+
+func TestLoadSessionMorePanesThanSplit(t *testing.T) {
+	fake := newFakeYakuake(t)
+	configuration := readTestConfig(t, `
+profiles:
+  - name: dev
+    tabs:
+      - name: logs
+        split: tb
+        panes:
+          - commands: [echo 1]
+          - commands: [echo 2]
+          - commands: [echo 3]
+          - commands: [echo 4]
+          - name: five
+            commands: [echo 5]
+`)
+	captureOutput(t)
+
+	if err := LoadSession(configuration, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	// the single terminal of the tab is split on top of each other for all five panes
+	session := sessionByTitle(t, fake, "logs")
+	if len(session.Terminals) != 5 || len(session.Splits) != 4 {
+		t.Fatalf("expected five terminals, got %+v", session)
+	}
+	for _, split := range session.Splits {
+		if split.Direction != "tb" {
+			t.Errorf("unexpected split %+v", split)
+		}
+	}
+	var commands []string
+	for _, terminalID := range session.Terminals {
+		commands = append(commands, fake.Commands(terminalID)...)
+	}
+	sort.Strings(commands)
+	if !reflect.DeepEqual(commands, []string{"echo 1", "echo 2", "echo 3", "echo 4", "echo 5"}) {
+		t.Errorf("unexpected commands %v", commands)
+	}
+
+	// panes are counted in the order of their terminals
+	terminalIDs, err := SelectTerminals(configuration, TerminalSelection{Profiles: []string{"dev"}, Pane: "five"})
+	if err != nil || len(terminalIDs) != 1 || !reflect.DeepEqual(fake.Commands(terminalIDs[0]), []string{"echo 5"}) {
+		t.Errorf("unexpected terminal of pane five %v %v", terminalIDs, err)
+	}
+}
+
+func TestDryRunLayout(t *testing.T) {
+	newFakeYakuake(t)
+	configuration := readTestConfig(t, layoutTestConfig)
+	captureOutput(t)
+	recorder := newDryRunYakuake(yakuake)
+	yakuake = recorder
+
+	if err := LoadSession(configuration, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	operations := strings.Join(recorder.Operations(), "\n")
+	for _, expected := range []string{
+		"splitTerminalLeftRight(1000001) = 1000002",
+		"splitTerminalLeftRight(1000002) = 1000003",
+		"splitTerminalTopBottom(1000002) = 1000004",
+		`runCommandInTerminal(1000004, "git status")`,
+	} {
+		if !strings.Contains(operations, expected) {
+			t.Errorf("missing operation '%s' in\n%s", expected, operations)
+		}
+	}
+}
+
+func TestSplitIndex(t *testing.T) {
+	for _, testCase := range []struct {
+		sizes    []int
+		expected int
+	}{
+		{sizes: []int{0, 0}, expected: 1},
+		{sizes: []int{0, 0, 0}, expected: 1},
+		{sizes: []int{25, 25, 50}, expected: 2},
+		{sizes: []int{1, 1, 1, 1, 1, 1}, expected: 3},
+		{sizes: []int{3, 1, 1, 1}, expected: 1},
+		{sizes: []int{60, 0, 0}, expected: 1},
+		{sizes: []int{1, 1, 1, 3}, expected: 3},
+	} {
+		var children []LayoutDescription
+		for _, size := range testCase.sizes {
+			children = append(children, LayoutDescription{Size: size})
+		}
+		if index := splitIndex(children); index != testCase.expected {
+			t.Errorf("%v: expected index %d, got %d", testCase.sizes, testCase.expected, index)
+		}
+	}
+}
+
+func TestReadConfigLayoutValidation(t *testing.T) {
+	content := `profiles:
+  - name: dev
+    tabs:
+      - name: a
+        split: lr
+        layout:
+          children:
+            - commands: [ls]
+      - name: b
+        layout:
+          split: diagonal
+          commands: [ls]
+          children:
+            - size: -1
+            - split: tb
+`
+	dir := writeConfigFiles(t, map[string]string{".yakctl.yml": content})
+	_, err := ReadConfig(dir + "/.yakctl.yml")
+	expected := []string{
+		":5:9: 'split' can't be combined with 'layout', the layout describes all panes",
+		":8:13: panes with 'children' need a 'split': lr or tb",
+		":8:13: a split needs at least two children",
+		":11:18: invalid split 'diagonal' of a layout, valid splits: lr, tb",
+		":12:21: panes with 'children' have no commands, the commands belong to the children",
+		":14:21: the size of a pane has to be positive",
+		":15:22: a split needs 'children'",
+	}
+	for _, problem := range expected {
+		if err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("missing problem '%s' in\n%v", problem, err)
+		}
+	}
+}
+
+func TestSnapshotLayout(t *testing.T) {
+	fake := newFakeYakuake(t)
+	if _, err := fake.SplitTerminalLeftRight(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.SplitTerminalTopBottom(1); err != nil {
+		t.Fatal(err)
+	}
+	fake.SetWorkingDirectory(0, "/a")
+	fake.SetWorkingDirectory(2, "/c")
+
+	profile, err := TakeSnapshot("snap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &LayoutDescription{Split: "lr", Children: []LayoutDescription{
+		{PaneDescription: PaneDescription{Workdir: "/a"}},
+		{},
+		{PaneDescription: PaneDescription{Workdir: "/c"}},
+	}}
+	if !reflect.DeepEqual(profile.Tabs[0].Layout, expected) {
+		t.Errorf("unexpected layout %+v", profile.Tabs[0].Layout)
+	}
+}
@@ -0,0 +1,278 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+)
+
+// resolveConfiguration expands tab templates and profile inheritance in the yaml document,
+// so the decoded configuration only contains complete profiles
+func resolveConfiguration(document *yaml.Node, sources sourceMap) error {
+	root := document
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	templates := map[string]*yaml.Node{}
+	if templatesNode := mappingValue(root, "templates"); templatesNode != nil {
+		if templatesNode.Kind != yaml.SequenceNode {
+			return fmt.Errorf("%s: 'templates' has to be a list of tabs", sources.position(templatesNode))
+		}
+		for _, template := range templatesNode.Content {
+			name := scalarValue(template, "name")
+			if len(name) == 0 {
+				return fmt.Errorf("%s: template without name", sources.position(template))
+			}
+			if existing, exists := templates[name]; exists {
+				return fmt.Errorf("%s: template '%s' is already defined at %s", sources.position(template), name, sources.position(existing))
+			}
+			templates[name] = template
+		}
+	}
+
+	profilesNode := mappingValue(root, "profiles")
+	if profilesNode == nil || profilesNode.Kind != yaml.SequenceNode {
+		return nil
+	}
+	resolver := &profileResolver{
+		sources:   sources,
+		templates: templates,
+		profiles:  map[string]*yaml.Node{},
+		resolved:  map[*yaml.Node]*yaml.Node{},
+		resolving: map[*yaml.Node]bool{},
+	}
+	for _, profile := range profilesNode.Content {
+		if name := scalarValue(profile, "name"); len(name) > 0 {
+			if _, exists := resolver.profiles[name]; !exists {
+				resolver.profiles[name] = profile
+			}
+		}
+	}
+	for i, profile := range profilesNode.Content {
+		resolved, err := resolver.resolveProfile(profile)
+		if err != nil {
+			return err
+		}
+		profilesNode.Content[i] = resolved
+	}
+	return nil
+}
+
+type profileResolver struct {
+	sources   sourceMap
+	templates map[string]*yaml.Node
+	profiles  map[string]*yaml.Node
+	resolved  map[*yaml.Node]*yaml.Node
+	resolving map[*yaml.Node]bool
+}
+
+// resolve the parent profile and the templates of a profile
+func (r *profileResolver) resolveProfile(profile *yaml.Node) (*yaml.Node, error) {
+	if resolved, done := r.resolved[profile]; done {
+		return resolved, nil
+	}
+	if profile.Kind != yaml.MappingNode {
+		return profile, nil
+	}
+	if r.resolving[profile] {
+		return nil, fmt.Errorf("%s: profile '%s' is part of an inheritance cycle", r.sources.position(profile), scalarValue(profile, "name"))
+	}
+	r.resolving[profile] = true
+	defer delete(r.resolving, profile)
+
+	var tabs []*yaml.Node
+	if tabsNode := mappingValue(profile, "tabs"); tabsNode != nil && tabsNode.Kind == yaml.SequenceNode {
+		for _, tab := range tabsNode.Content {
+			resolvedTab, err := r.resolveTab(tab)
+			if err != nil {
+				return nil, err
+			}
+			tabs = append(tabs, resolvedTab)
+		}
+	}
+
+	result := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: profile.Line, Column: profile.Column}
+	r.sources[result] = r.sources[profile]
+	if extendsNode := mappingValue(profile, "extends"); extendsNode != nil {
+		parent, exists := r.profiles[extendsNode.Value]
+		if !exists {
+			return nil, fmt.Errorf("%s: profile '%s' extends unknown profile '%s'", r.sources.position(extendsNode), scalarValue(profile, "name"), extendsNode.Value)
+		}
+		resolvedParent, err := r.resolveProfile(parent)
+		if err != nil {
+			return nil, err
+		}
+		result = r.sources.copy(resolvedParent)
+		result.Line, result.Column = profile.Line, profile.Column
+		r.sources[result] = r.sources[profile]
+
+		// own tabs override inherited tabs of the same name or are appended
+		inheritedTabs := mappingValue(result, "tabs")
+		var merged []*yaml.Node
+		if inheritedTabs != nil {
+			merged = inheritedTabs.Content
+		}
+		for _, tab := range tabs {
+			index := -1
+			for i, inherited := range merged {
+				if scalarValue(inherited, "name") == scalarValue(tab, "name") {
+					index = i
+					break
+				}
+			}
+			if index >= 0 {
+				merged[index] = r.sources.merge(merged[index], tab)
+			} else {
+				merged = append(merged, tab)
+			}
+		}
+		tabs = merged
+	}
+
+	for i := 0; i+1 < len(profile.Content); i += 2 {
+		key, value := profile.Content[i], profile.Content[i+1]
+		switch key.Value {
+		case "extends", "tabs":
+			continue
+		case "vars":
+			// variables are inherited one by one
+			if inherited := mappingValue(result, "vars"); inherited != nil && inherited.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+				value = r.sources.merge(inherited, value)
+			}
+		}
+		setMappingValue(result, key, value)
+	}
+	if len(tabs) > 0 || mappingValue(profile, "tabs") != nil {
+		tabsKey := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "tabs"}
+		tabsNode := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: tabs}
+		if original := mappingValue(profile, "tabs"); original != nil {
+			tabsNode.Line, tabsNode.Column = original.Line, original.Column
+		}
+		r.sources[tabsNode] = r.sources[profile]
+		setMappingValue(result, tabsKey, tabsNode)
+	}
+	r.resolved[profile] = result
+	return result, nil
+}
+
+// a tab with a template consists of the template with the keys of the tab replacing the ones of the template
+func (r *profileResolver) resolveTab(tab *yaml.Node) (*yaml.Node, error) {
+	templateNode := mappingValue(tab, "template")
+	if templateNode == nil {
+		return tab, nil
+	}
+	template, exists := r.templates[templateNode.Value]
+	if !exists {
+		return nil, fmt.Errorf("%s: unknown template '%s'", r.sources.position(templateNode), templateNode.Value)
+	}
+	resolved := r.sources.merge(template, tab)
+	removeMappingKey(resolved, "template")
+	return resolved, nil
+}
+
+// get the value of a key of a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// get the value of a scalar key of a mapping node, empty if it is missing
+func scalarValue(node *yaml.Node, key string) string {
+	value := mappingValue(node, key)
+	if value == nil || value.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return value.Value
+}
+
+func setMappingValue(node *yaml.Node, key *yaml.Node, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key.Value {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, key, value)
+}
+
+func removeMappingKey(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// sourceMap remembers the file each node of a configuration was read from
+type sourceMap map[*yaml.Node]string
+
+// remember the file of a node and all its children
+func (s sourceMap) add(node *yaml.Node, file string) {
+	s[node] = file
+	for _, child := range node.Content {
+		s.add(child, file)
+	}
+}
+
+// position of a node as file:line:column, only the file if the format does not tell positions
+func (s sourceMap) position(node *yaml.Node) string {
+	if node.Line == 0 {
+		return s[node]
+	}
+	return fmt.Sprintf("%s:%d:%d", s[node], node.Line, node.Column)
+}
+
+// deep copy of a node, so merged nodes do not share their content. Copies keep the file of the original.
+func (s sourceMap) copy(node *yaml.Node) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	copied := *node
+	copied.Content = nil
+	for _, child := range node.Content {
+		copied.Content = append(copied.Content, s.copy(child))
+	}
+	s[&copied] = s[node]
+	return &copied
+}
+
+// copy of base with all keys of override replacing or added to the ones of base
+func (s sourceMap) merge(base *yaml.Node, override *yaml.Node) *yaml.Node {
+	result := s.copy(base)
+	result.Line, result.Column = override.Line, override.Column
+	s[result] = s[override]
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		setMappingValue(result, override.Content[i], s.copy(override.Content[i+1]))
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const inheritanceTestConfig = `
+templates:
+  - name: ssh
+    protected: true
+    monitorActivity: true
+    commands:
+      - ssh pi@10.10.10.11
+profiles:
+  - name: base
+    clear: true
+    tabs:
+      - name: pi1
+        template: ssh
+      - name: pi2
+        template: ssh
+        protected: false
+        commands:
+          - ssh pi@10.10.10.12
+  - name: work
+    extends: base
+    force: true
+    tabs:
+      - name: pi2
+        monitorActivity: false
+      - name: editor
+        commands:
+          - vim
+  - name: more
+    extends: work
+    clear: false
+`
+
+func TestReadConfigTemplatesAndInheritance(t *testing.T) {
+	configuration := readTestConfig(t, inheritanceTestConfig)
+
+	base, _ := GetProfile(configuration, "base")
+	expectedBase := &ProfileDescription{Name: "base", ClearAll: true, Tabs: []TabDescription{
+		{Name: "pi1", Protected: true, MonitorActivity: true, Commands: []Command{{Run: "ssh pi@10.10.10.11"}}},
+		{Name: "pi2", MonitorActivity: true, Commands: []Command{{Run: "ssh pi@10.10.10.12"}}},
+	}}
+	if !reflect.DeepEqual(base, expectedBase) {
+		t.Errorf("unexpected profile\n%+v\nexpected\n%+v", base, expectedBase)
+	}
+
+	work, _ := GetProfile(configuration, "work")
+	expectedWork := &ProfileDescription{Name: "work", ClearAll: true, ForceClear: true, Tabs: []TabDescription{
+		{Name: "pi1", Protected: true, MonitorActivity: true, Commands: []Command{{Run: "ssh pi@10.10.10.11"}}},
+		{Name: "pi2", Commands: []Command{{Run: "ssh pi@10.10.10.12"}}},
+		{Name: "editor", Commands: []Command{{Run: "vim"}}},
+	}}
+	if !reflect.DeepEqual(work, expectedWork) {
+		t.Errorf("unexpected profile\n%+v\nexpected\n%+v", work, expectedWork)
+	}
+
+	more, _ := GetProfile(configuration, "more")
+	if more.ClearAll || !more.ForceClear || !reflect.DeepEqual(more.Tabs, expectedWork.Tabs) {
+		t.Errorf("unexpected profile %+v", more)
+	}
+}
+
+func TestReadConfigInheritanceErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		content string
+		err     string
+	}{
+		{
+			content: "profiles:\n  - name: a\n    tabs:\n      - name: x\n        template: missing\n",
+			err:     ".yakctl.yml:5:19: unknown template 'missing'",
+		},
+		{
+			content: "profiles:\n  - name: a\n    extends: b\n  - name: b\n    extends: a\n",
+			err:     "is part of an inheritance cycle",
+		},
+		{
+			content: "profiles:\n  - name: a\n    extends: c\n",
+			err:     ".yakctl.yml:3:14: profile 'a' extends unknown profile 'c'",
+		},
+		{
+			content: "templates:\n  - name: t\n  - name: t\nprofiles: []\n",
+			err:     ".yakctl.yml:3:5: template 't' is already defined at ",
+		},
+	} {
+		file := filepath.Join(t.TempDir(), ".yakctl.yml")
+		if err := os.WriteFile(file, []byte(testCase.content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ReadConfig(file)
+		if err == nil || !strings.Contains(err.Error(), testCase.err) {
+			t.Errorf("expected error '%s', got %v", testCase.err, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// descriptions of the configuration keys by struct and field name, shown by editors using the schema.
+// Every field of the configuration structs needs a description, which is checked by a test.
+var schemaDescriptions = map[string]string{
+	"YakCtlConfiguration":           "yakctl configuration, see https://github.com/emschu/yakctl",
+	"YakCtlConfiguration.Include":   "file or list of files and glob patterns whose profiles and templates are added, relative to this file",
+	"YakCtlConfiguration.Profiles":  "the profiles, addressed by their name or number",
+	"YakCtlConfiguration.Templates": "tabs profiles can refer to by 'template: <name>'",
+
+	"ProfileDescription":            "a profile describing tabs to open",
+	"ProfileDescription.Name":       "unique name of the profile",
+	"ProfileDescription.Extends":    "name of a profile whose tabs and flags are inherited, tabs of the same name are merged",
+	"ProfileDescription.Vars":       "variables used in tab names and commands as {{ .name }}, variables without value have to be set by --set name=value",
+	"ProfileDescription.Tabs":       "the tabs of the profile in the order they are opened",
+	"ProfileDescription.ClearAll":   "close all other tabs, except the protected ones",
+	"ProfileDescription.ForceClear": "close protected tabs, too, if 'clear' is set",
+
+	"TabDescription":                      "a yakuake tab, or the name of a template",
+	"TabDescription.Name":                 "title of the tab",
+	"TabDescription.Template":             "name of a template whose keys are used if this tab does not set them",
+	"TabDescription.Workdir":              "working directory of all terminals of the tab, changed to before all commands",
+	"TabDescription.Env":                  "environment variables exported in all terminals of the tab before all commands",
+	"TabDescription.Commands":             "commands executed in all terminals of the tab, before the commands of the single terminals",
+	"TabDescription.SplitMode":            "split of the tab: left-right (lr), top-bottom (tb) or four terminals (quad)",
+	"TabDescription.Terminal1":            "commands executed in the first terminal",
+	"TabDescription.Terminal2":            "commands executed in the second terminal, needs a split",
+	"TabDescription.Terminal3":            "commands executed in the third terminal, needs split 'quad'",
+	"TabDescription.Terminal4":            "commands executed in the fourth terminal, needs split 'quad'",
+	"TabDescription.Protected":            "the tab can't be closed by yakuake and is only closed by yakctl with 'force'",
+	"TabDescription.MonitorSilence":       "notify about silence in the tab",
+	"TabDescription.MonitorActivity":      "notify about activity in the tab",
+	"TabDescription.DisableKeyboardInput": "ignore keyboard input in the tab",
+	"TabDescription.Panes":                "the terminals of the tab in order, more panes than terminals of 'split' get one terminal each, 'terminal1' to 'terminal4' add commands to the first four panes",
+	"TabDescription.Layout":               "the panes of the tab, instead of 'split' and 'terminal1' to 'terminal4'",
+
+	"LayoutDescription":          "a pane, or a part of the tab split into further panes",
+	"LayoutDescription.Split":    "direction the children are split in: side by side (lr) or on top of each other (tb)",
+	"LayoutDescription.Children": "the panes this part is split into",
+	"LayoutDescription.Size":     "size relative to the siblings, a list of panes is halved where the sizes of both halves are closest",
+
+	"Command":          "a command, given as text or with options",
+	"Command.Run":      "the command run in the terminal",
+	"Command.Delay":    "duration to wait before the command is run, e.g. 500ms or 2s",
+	"Command.WaitFor":  "name of the process which has to be in the foreground of the terminal before the command is run, e.g. ssh",
+	"Command.SendKeys": "text typed into the terminal as it is instead of 'run', e.g. an answer to a prompt",
+	"Command.If":       "shell command evaluated locally, the command is skipped if it fails",
+	"Command.Expect":   "text which has to appear in the terminal after the command, before the next command is run",
+	"Command.Retry":    "how often the command is repeated if the text of 'expect' does not appear",
+
+	"PaneDescription":                      "a single terminal of a tab",
+	"PaneDescription.Name":                 "name of the pane, for reference",
+	"PaneDescription.Commands":             "commands executed in the pane, after the commands of the tab",
+	"PaneDescription.Workdir":              "working directory of the pane, changed to before all commands, replaces the one of the tab",
+	"PaneDescription.Env":                  "environment variables exported in the pane before all commands, added to the ones of the tab",
+	"PaneDescription.DisableKeyboardInput": "ignore keyboard input in the pane",
+}
+
+// allowed values of configuration keys by struct and field name, they are accepted in any case
+var schemaValues = map[string]func() []string{
+	"TabDescription.SplitMode": splitModes,
+	"LayoutDescription.Split": func() []string {
+		return sortedKeys(layoutSplits)
+	},
+}
+
+// schemas replacing the generated ones of fields accepting several forms
+var schemaOverrides = map[string]map[string]interface{}{
+	"YakCtlConfiguration.Include": {
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	},
+}
+
+// keys every entry has to define, by struct name
+var schemaRequired = map[string][]string{
+	"ProfileDescription": {"name"},
+}
+
+// ConfigSchema returns a JSON schema of the configuration file
+func ConfigSchema() ([]byte, error) {
+	generator := &schemaGenerator{definitions: map[string]interface{}{}}
+	configurationType := reflect.TypeOf(YakCtlConfiguration{})
+	schema := generator.object(configurationType)
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "yakctl configuration"
+	schema["$defs"] = generator.definitions
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// schemaGenerator derives JSON schemas from the yaml keys of the configuration structs
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+func (g *schemaGenerator) schema(valueType reflect.Type) map[string]interface{} {
+	nullable := false
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+		nullable = true
+	}
+	var schema map[string]interface{}
+	switch valueType.Kind() {
+	case reflect.Struct:
+		name := valueType.Name()
+		if _, exists := g.definitions[name]; !exists {
+			g.definitions[name] = nil
+			object := g.object(valueType)
+			if textForms[valueType] {
+				description := object["description"]
+				delete(object, "description")
+				g.definitions[name] = map[string]interface{}{
+					"description": description,
+					"oneOf":       []interface{}{map[string]interface{}{"type": "string"}, object},
+				}
+			} else {
+				g.definitions[name] = object
+			}
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	case reflect.Slice:
+		schema = map[string]interface{}{"type": "array", "items": g.schema(valueType.Elem())}
+	case reflect.Map:
+		schema = map[string]interface{}{"type": "object", "additionalProperties": g.schema(valueType.Elem())}
+	case reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case reflect.Int:
+		schema = map[string]interface{}{"type": "integer", "minimum": 0}
+	default:
+		schema = map[string]interface{}{"type": "string"}
+	}
+	if nullable {
+		schema["type"] = []string{schema["type"].(string), "null"}
+	}
+	return schema
+}
+
+// the schema of a struct, a mapping of its yaml keys
+func (g *schemaGenerator) object(structType reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for key, field := range yamlFields(structType) {
+		name := field.Owner.Name() + "." + field.Name
+		property, overridden := schemaOverrides[name]
+		if !overridden {
+			property = g.schema(field.Type)
+		}
+		if description, exists := schemaDescriptions[name]; exists {
+			property["description"] = description
+		}
+		if values, exists := schemaValues[name]; exists {
+			property["pattern"] = caseInsensitivePattern(values())
+		}
+		properties[key] = property
+	}
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"description":          schemaDescriptions[structType.Name()],
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if required, exists := schemaRequired[structType.Name()]; exists {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// a pattern matching the values in any case. JSON schema patterns have no flags, so each letter becomes a class.
+func caseInsensitivePattern(values []string) string {
+	var alternatives []string
+	for _, value := range values {
+		var alternative strings.Builder
+		for _, r := range value {
+			upper, lower := unicode.ToUpper(r), unicode.ToLower(r)
+			if upper == lower {
+				alternative.WriteString(regexp.QuoteMeta(string(r)))
+				continue
+			}
+			alternative.WriteString("[" + string(upper) + string(lower) + "]")
+		}
+		alternatives = append(alternatives, alternative.String())
+	}
+	return "^(" + strings.Join(alternatives, "|") + ")$"
+}
+
+// the names of all split modes, lower case
+func splitModes() []string {
+	var modes []string
+	for _, mode := range sortedKeys(splitModeTerminals) {
+		if len(mode) > 0 {
+			modes = append(modes, mode)
+		}
+	}
+	return modes
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,114 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// every key of the configuration needs a description, so it is documented in the schema
+func TestConfigSchemaCoverage(t *testing.T) {
+	visited := map[reflect.Type]bool{}
+	var check func(valueType reflect.Type)
+	check = func(valueType reflect.Type) {
+		for valueType.Kind() == reflect.Ptr || valueType.Kind() == reflect.Slice || valueType.Kind() == reflect.Map {
+			valueType = valueType.Elem()
+		}
+		if valueType.Kind() != reflect.Struct || visited[valueType] {
+			return
+		}
+		visited[valueType] = true
+		if _, exists := schemaDescriptions[valueType.Name()]; !exists {
+			t.Errorf("missing schema description of '%s'", valueType.Name())
+		}
+		for _, field := range yamlFields(valueType) {
+			name := field.Owner.Name() + "." + field.Name
+			if _, exists := schemaDescriptions[name]; !exists {
+				t.Errorf("missing schema description of '%s'", name)
+			}
+			check(field.Type)
+		}
+	}
+	check(reflect.TypeOf(YakCtlConfiguration{}))
+
+	for name := range schemaDescriptions {
+		found := false
+		for structType := range visited {
+			found = found || name == structType.Name()
+			if _, exists := yamlFieldByName(structType, name); exists {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("schema description of unknown field '%s'", name)
+		}
+	}
+}
+
+func yamlFieldByName(structType reflect.Type, name string) (yamlField, bool) {
+	for _, field := range yamlFields(structType) {
+		if field.Owner.Name()+"."+field.Name == name {
+			return field, true
+		}
+	}
+	return yamlField{}, false
+}
+
+func TestConfigSchema(t *testing.T) {
+	schema, err := ConfigSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(schema, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	tab := parsed["$defs"].(map[string]interface{})["TabDescription"].(map[string]interface{})
+	split := tab["properties"].(map[string]interface{})["split"].(map[string]interface{})
+	// splits are accepted in any case like the validator does
+	pattern := regexp.MustCompile(split["pattern"].(string))
+	for _, value := range []string{"lr", "LR", "Quad", "top-bottom", "Vertical"} {
+		if !pattern.MatchString(value) {
+			t.Errorf("split '%s' should match %s", value, pattern)
+		}
+	}
+	for _, value := range []string{"diagonal", "lrx", "q"} {
+		if pattern.MatchString(value) {
+			t.Errorf("split '%s' should not match %s", value, pattern)
+		}
+	}
+	profiles := parsed["properties"].(map[string]interface{})["profiles"].(map[string]interface{})
+	if profiles["items"].(map[string]interface{})["$ref"] != "#/$defs/ProfileDescription" {
+		t.Errorf("unexpected profiles schema %v", profiles)
+	}
+
+	// the published schema has to be up to date, regenerate it with 'yakctl config schema > yakctl.schema.json'
+	published, err := os.ReadFile("yakctl.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(published) != string(schema)+"\n" {
+		t.Error("yakctl.schema.json is outdated")
+	}
+}
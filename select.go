@@ -0,0 +1,278 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// kinds of selectors given to --exclude as kind:value, the kind is required and the value is everything after
+// the first colon, so tab titles may contain colons
+const (
+	SelectorTerminal = "terminal"
+	SelectorSession  = "session"
+	SelectorTab      = "tab"
+	SelectorProfile  = "profile"
+	SelectorActive   = "active"
+)
+
+// TerminalSelection selects terminals of the open tabs, all terminals if nothing is selected
+type TerminalSelection struct {
+	Terminals []int
+	Sessions  []int
+	// patterns of tab titles, see titlePattern
+	Tabs []string
+	// profiles whose tabs are selected, matched by title like 'profile apply' does
+	Profiles  []string
+	Variables map[string]string
+	// the active terminal
+	Active bool
+	// number (starting at 1) or name of a pane, only this pane of the selected tabs is selected
+	Pane string
+	// selectors of terminals which are not selected
+	Exclude []string
+}
+
+// an open tab and its description, if it was selected by a profile
+type selectedTab struct {
+	state sessionState
+	tab   *TabDescription
+}
+
+// SelectTerminals resolves a selection to the ids of the terminals of the open tabs.
+// Every selector has to match at least one terminal.
+func SelectTerminals(configuration *YakCtlConfiguration, selection TerminalSelection) ([]int, error) {
+	states, err := readSessionStates()
+	if err != nil {
+		return nil, err
+	}
+	var tabs []selectedTab
+	for _, sessionID := range selection.Sessions {
+		state, err := sessionByID(states, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		tabs = append(tabs, selectedTab{state: state})
+	}
+	for _, pattern := range selection.Tabs {
+		matches, err := sessionsWithTitle(states, pattern)
+		if err != nil {
+			return nil, err
+		}
+		tabs = appendTabs(tabs, matches)
+	}
+	for _, profileName := range selection.Profiles {
+		profileTabs, err := openTabsOfProfile(configuration, profileName, selection.Variables, states)
+		if err != nil {
+			return nil, err
+		}
+		tabs = append(tabs, profileTabs...)
+	}
+	if len(tabs) == 0 && len(selection.Pane) > 0 {
+		tabs = appendTabs(tabs, states)
+	}
+
+	var terminalIDs []int
+	for _, tab := range tabs {
+		terminalIDs = append(terminalIDs, tabTerminals(tab, selection.Pane)...)
+	}
+	if len(tabs) > 0 && len(terminalIDs) == 0 {
+		return nil, fmt.Errorf("no selected tab has the pane '%s'", selection.Pane)
+	}
+	for _, terminalID := range selection.Terminals {
+		if !terminalExists(states, terminalID) {
+			return nil, fmt.Errorf("no terminal #%d", terminalID)
+		}
+		terminalIDs = append(terminalIDs, terminalID)
+	}
+	if selection.Active {
+		terminalID, err := activeTerminalID()
+		if err != nil {
+			return nil, err
+		}
+		terminalIDs = append(terminalIDs, terminalID)
+	}
+	if len(terminalIDs) == 0 {
+		for _, state := range states {
+			terminalIDs = append(terminalIDs, state.Terminals...)
+		}
+	}
+
+	excluded := map[int]bool{}
+	for _, selector := range selection.Exclude {
+		ids, err := selectorTerminals(configuration, selector, selection.Variables, states)
+		if err != nil {
+			return nil, fmt.Errorf("exclusion '%s': %v", selector, err)
+		}
+		for _, id := range ids {
+			excluded[id] = true
+		}
+	}
+	var selected []int
+	seen := map[int]bool{}
+	for _, terminalID := range terminalIDs {
+		if !excluded[terminalID] && !seen[terminalID] {
+			seen[terminalID] = true
+			selected = append(selected, terminalID)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("all selected terminals are excluded")
+	}
+	return selected, nil
+}
+
+// IsEmpty is true if the selection selects all terminals
+func (s *TerminalSelection) IsEmpty() bool {
+	return len(s.Terminals) == 0 && len(s.Sessions) == 0 && len(s.Tabs) == 0 && len(s.Profiles) == 0 && !s.Active &&
+		len(s.Pane) == 0 && len(s.Exclude) == 0
+}
+
+// the terminals of a single selector like terminal:4, session:2, tab:build-*, profile:work or active
+func selectorTerminals(configuration *YakCtlConfiguration, selector string, variables map[string]string, states []sessionState) ([]int, error) {
+	kind, value, found := strings.Cut(selector, ":")
+	switch {
+	case !found && selector != SelectorActive,
+		found && kind != SelectorTerminal && kind != SelectorSession && kind != SelectorTab && kind != SelectorProfile:
+		return nil, fmt.Errorf("invalid selector, expected terminal:ids, session:ids, tab:pattern, profile:name or active")
+	case selector == SelectorActive:
+		terminalID, err := activeTerminalID()
+		if err != nil {
+			return nil, err
+		}
+		return []int{terminalID}, nil
+	case kind == SelectorTerminal || kind == SelectorSession:
+		ids, err := parseIDList(value)
+		if err != nil {
+			return nil, err
+		}
+		var terminalIDs []int
+		for _, id := range ids {
+			if kind == SelectorTerminal {
+				if !terminalExists(states, id) {
+					return nil, fmt.Errorf("no terminal #%d", id)
+				}
+				terminalIDs = append(terminalIDs, id)
+				continue
+			}
+			state, err := sessionByID(states, id)
+			if err != nil {
+				return nil, err
+			}
+			terminalIDs = append(terminalIDs, state.Terminals...)
+		}
+		return terminalIDs, nil
+	case kind == SelectorProfile:
+		tabs, err := openTabsOfProfile(configuration, value, variables, states)
+		if err != nil {
+			return nil, err
+		}
+		var terminalIDs []int
+		for _, tab := range tabs {
+			terminalIDs = append(terminalIDs, tab.state.Terminals...)
+		}
+		return terminalIDs, nil
+	}
+	matches, err := sessionsWithTitle(states, value)
+	if err != nil {
+		return nil, err
+	}
+	var terminalIDs []int
+	for _, state := range matches {
+		terminalIDs = append(terminalIDs, state.Terminals...)
+	}
+	return terminalIDs, nil
+}
+
+// the id of the active terminal, there may be none without an active session
+func activeTerminalID() (int, error) {
+	terminalID, err := yakuake.ActiveTerminalID()
+	if err != nil {
+		return -1, err
+	}
+	if terminalID < 0 {
+		return -1, fmt.Errorf("no active terminal")
+	}
+	return terminalID, nil
+}
+
+// the open tabs of a profile, matched by title, at least one has to be open
+func openTabsOfProfile(configuration *YakCtlConfiguration, profileName string, variables map[string]string, states []sessionState) ([]selectedTab, error) {
+	profile, err := getRenderedProfile(configuration, profileName, variables)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVariablesDeclared([]*ProfileDescription{profile}, variables); err != nil {
+		return nil, err
+	}
+	var tabs []selectedTab
+	for i, state := range matchTabs(profile.Tabs, states) {
+		if state != nil {
+			tabs = append(tabs, selectedTab{state: *state, tab: &profile.Tabs[i]})
+		}
+	}
+	if len(tabs) == 0 {
+		return nil, fmt.Errorf("no open tab of profile '%s'", profile.Name)
+	}
+	return tabs, nil
+}
+
+func appendTabs(tabs []selectedTab, states []sessionState) []selectedTab {
+	for _, state := range states {
+		tabs = append(tabs, selectedTab{state: state})
+	}
+	return tabs
+}
+
+// the terminals of a tab, only the one of the pane if a pane is given. Panes are counted in the order of the
+// terminal ids, names of panes are known for tabs selected by profile only.
+func tabTerminals(tab selectedTab, pane string) []int {
+	terminalIDs := append([]int(nil), tab.state.Terminals...)
+	sort.Ints(terminalIDs)
+	if len(pane) == 0 {
+		return terminalIDs
+	}
+	index := -1
+	if number, err := strconv.Atoi(pane); err == nil {
+		index = number - 1
+	} else if tab.tab != nil {
+		for i, description := range tab.tab.panesByTerminal() {
+			if description.Name == pane {
+				index = i
+				break
+			}
+		}
+	}
+	if index < 0 || index >= len(terminalIDs) {
+		return nil
+	}
+	return terminalIDs[index : index+1]
+}
+
+// the panes of a tab in the order of the terminals opened for them
+func (tab *TabDescription) panesByTerminal() []PaneDescription {
+	if layout := tab.effectiveLayout(); layout != nil {
+		return layout.panesByTerminal()
+	}
+	return tab.terminalPanes()
+}
@@ -0,0 +1,203 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const selectTestConfig = `
+profiles:
+  - name: dev
+    tabs:
+      - name: ide
+        layout:
+          split: lr
+          children:
+            - name: editor
+              commands: [echo editor]
+              size: 2
+            - split: tb
+              children:
+                - name: build
+                  commands: [echo build]
+                - name: git
+                  commands: [echo git]
+            - name: monitor
+              commands: [echo monitor]
+      - name: logs
+        split: lr
+        panes:
+          - name: app
+            commands: [echo app]
+          - name: db
+            commands: [echo db]
+`
+
+func TestSelectTerminals(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	sessions := openTitledSessions(t, fake, "build-1", "build-2", "logs")
+	terminals := map[string][]int{}
+	for title, sessionID := range sessions {
+		session, _ := fake.Session(sessionID)
+		terminals[title] = session.Terminals
+	}
+	fake.SetActiveTerminal(terminals["logs"][1])
+
+	for _, test := range []struct {
+		name      string
+		selection TerminalSelection
+		expected  []int
+	}{
+		{"tab", TerminalSelection{Tabs: []string{"build-*"}}, append(append([]int(nil), terminals["build-1"]...), terminals["build-2"]...)},
+		{"session", TerminalSelection{Sessions: []int{sessions["logs"]}}, terminals["logs"]},
+		{"terminal", TerminalSelection{Terminals: []int{0}}, []int{0}},
+		{"active", TerminalSelection{Active: true}, []int{terminals["logs"][1]}},
+		{"pane of a tab", TerminalSelection{Tabs: []string{"/^build/"}, Pane: "2"}, []int{terminals["build-1"][1], terminals["build-2"][1]}},
+		{"pane of all tabs", TerminalSelection{Pane: "2"}, []int{terminals["build-1"][1], terminals["build-2"][1], terminals["logs"][1]}},
+		{"exclude", TerminalSelection{Tabs: []string{"*"}, Exclude: []string{"tab:build-*", "active", "terminal:0"}}, terminals["logs"][:1]},
+		{"exclude from all", TerminalSelection{Exclude: []string{"session:" + joinIDs([]int{sessions["build-1"], sessions["build-2"]}), "tab:logs"}}, []int{0}},
+		{"duplicates", TerminalSelection{Sessions: []int{sessions["logs"]}, Active: true}, terminals["logs"]},
+	} {
+		selected, err := SelectTerminals(nil, test.selection)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(selected, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, selected)
+		}
+	}
+}
+
+func TestSelectTerminalsOfProfile(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	configuration := readTestConfig(t, selectTestConfig)
+	if err := LoadSession(configuration, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	ide := sessionByTitle(t, fake, "ide")
+	logs := sessionByTitle(t, fake, "logs")
+
+	selected, err := SelectTerminals(configuration, TerminalSelection{Profiles: []string{"dev"}, Exclude: []string{"tab:logs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(selected, ide.Terminals) {
+		t.Errorf("expected the terminals of the ide tab %v, got %v", ide.Terminals, selected)
+	}
+
+	selection := TerminalSelection{Profiles: []string{"dev"}, Variables: map[string]string{"typo": "x"}}
+	if _, err := SelectTerminals(configuration, selection); err == nil || !strings.Contains(err.Error(), "'typo' is not declared") {
+		t.Errorf("expected an error about the undeclared variable, got %v", err)
+	}
+
+	// the commands of the panes tell which terminal a pane got
+	for pane, expected := range map[string][]int{
+		"git":     {paneTerminal(t, fake, ide.Terminals, "git")},
+		"monitor": {paneTerminal(t, fake, ide.Terminals, "monitor")},
+		"db":      {logs.Terminals[1]},
+	} {
+		selected, err := SelectTerminals(configuration, TerminalSelection{Profiles: []string{"dev"}, Pane: pane})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(selected, expected) {
+			t.Errorf("pane '%s': expected %v, got %v", pane, expected, selected)
+		}
+	}
+}
+
+// the terminal of the ide tab whose pane runs the echo of the test configuration
+func paneTerminal(t *testing.T, fake interface{ Commands(int) []string }, terminalIDs []int, pane string) int {
+	t.Helper()
+	for _, terminalID := range terminalIDs {
+		for _, command := range fake.Commands(terminalID) {
+			if strings.Contains(command, "echo "+pane) {
+				return terminalID
+			}
+		}
+	}
+	t.Fatalf("no terminal runs the commands of pane '%s'", pane)
+	return -1
+}
+
+func TestSelectTerminalsNothingMatches(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	openTitledSessions(t, fake, "shell")
+	configuration := readTestConfig(t, selectTestConfig)
+
+	for _, selection := range []TerminalSelection{
+		{Tabs: []string{"build-*"}},
+		{Sessions: []int{42}},
+		{Terminals: []int{42}},
+		{Profiles: []string{"dev"}},
+		{Tabs: []string{"shell"}, Pane: "3"},
+		{Tabs: []string{"shell"}, Pane: "editor"},
+		{Tabs: []string{"shell"}, Exclude: []string{"tab:build-*"}},
+		{Tabs: []string{"shell"}, Exclude: []string{"tab:shell"}},
+		{Tabs: []string{"shell"}, Exclude: []string{"shell"}},
+		{Tabs: []string{"shell"}, Exclude: []string{"title:shell"}},
+	} {
+		if _, err := SelectTerminals(configuration, selection); err == nil {
+			t.Errorf("expected an error for %+v", selection)
+		}
+	}
+}
+
+func TestExcludeTabWithColon(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	sessions := openTitledSessions(t, fake, "ssh host:22", "ssh host:2222")
+	remaining, _ := fake.Session(sessions["ssh host:2222"])
+
+	// everything after the kind is the pattern
+	selected, err := SelectTerminals(nil, TerminalSelection{Tabs: []string{"ssh *"}, Exclude: []string{"tab:ssh host:22"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(selected, remaining.Terminals) {
+		t.Errorf("expected the terminals %v of 'ssh host:2222', got %v", remaining.Terminals, selected)
+	}
+	_, err = SelectTerminals(nil, TerminalSelection{Exclude: []string{"ssh host:22"}})
+	if err == nil || !strings.Contains(err.Error(), "expected terminal:ids, session:ids, tab:pattern, profile:name or active") {
+		t.Errorf("expected an error about the missing kind, got %v", err)
+	}
+}
+
+func TestSelectTerminalsWithoutActiveTerminal(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	fake.SetActiveSession(42)
+
+	for _, selection := range []TerminalSelection{
+		{Active: true},
+		{Exclude: []string{"active"}},
+	} {
+		if _, err := SelectTerminals(nil, selection); err == nil || !strings.Contains(err.Error(), "no active terminal") {
+			t.Errorf("expected an error about the missing active terminal for %+v, got %v", selection, err)
+		}
+	}
+}
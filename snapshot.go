@@ -0,0 +1,189 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TakeSnapshot describes the tabs currently opened in yakuake as a profile with the given name
+func TakeSnapshot(name string) (*ProfileDescription, error) {
+	states, err := readSessionStates()
+	if err != nil {
+		return nil, err
+	}
+	profile := &ProfileDescription{Name: name}
+	for _, state := range states {
+		profile.Tabs = append(profile.Tabs, *snapshotTab(&state))
+	}
+	return profile, nil
+}
+
+// describe a single session as tab
+func snapshotTab(state *sessionState) *TabDescription {
+	tab := &TabDescription{
+		Name:                 state.Title,
+		Protected:            state.Protected,
+		MonitorSilence:       state.MonitorSilence,
+		MonitorActivity:      state.MonitorActivity,
+		DisableKeyboardInput: state.DisableKeyboardInput,
+	}
+	terminalIDs := state.Terminals
+
+	// yakuake does not tell the direction of a split, so two terminals are always described as left-right split
+	switch len(terminalIDs) {
+	case 0:
+		return tab
+	case 1:
+	case 2:
+		tab.SplitMode = "lr"
+	case 4:
+		tab.SplitMode = "quad"
+	default:
+		// only the number of terminals is known, they are described side by side
+		tab.Layout = &LayoutDescription{Split: "lr", Children: make([]LayoutDescription, len(terminalIDs))}
+	}
+
+	// working directories are optional, konsole does not expose them in every setup
+	var directories []string
+	for _, terminalID := range terminalIDs {
+		directory, dirErr := yakuake.TerminalWorkingDirectory(terminalID)
+		if dirErr != nil {
+			directory = ""
+		}
+		directories = append(directories, directory)
+	}
+	if allEqual(directories) {
+		if len(directories[0]) > 0 {
+			tab.Workdir = directories[0]
+		}
+		return tab
+	}
+	for i, directory := range directories {
+		if tab.Layout != nil {
+			tab.Layout.Children[i].Workdir = directory
+		} else {
+			tab.Panes = append(tab.Panes, PaneDescription{Workdir: directory})
+		}
+	}
+	for len(tab.Panes) > 0 && len(tab.Panes[len(tab.Panes)-1].Workdir) == 0 {
+		tab.Panes = tab.Panes[:len(tab.Panes)-1]
+	}
+	return tab
+}
+
+// MarshalProfileEntry formats a profile as entry of the profiles list of a configuration file
+func MarshalProfileEntry(profile *ProfileDescription) ([]byte, error) {
+	marshal, err := marshalYAML([]ProfileDescription{*profile})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, line := range strings.SplitAfter(string(marshal), "\n") {
+		if len(strings.TrimSpace(line)) > 0 {
+			buf.WriteString("  ")
+		}
+		buf.WriteString(line)
+	}
+	return buf.Bytes(), nil
+}
+
+// AppendProfile appends a profile to the profiles list at the end of a configuration file.
+// The file is restored if the profile can't be read afterwards, e.g. because 'profiles' is not the last key.
+func AppendProfile(configFile string, configuration *YakCtlConfiguration, profile *ProfileDescription) error {
+	if configuration.Profiles != nil {
+		for _, existing := range *configuration.Profiles {
+			if existing.Name == profile.Name {
+				return fmt.Errorf("a profile named '%s' already exists in '%s'", profile.Name, configFile)
+			}
+		}
+	}
+	if configFormat(configFile) != FormatYAML {
+		return fmt.Errorf("profiles can only be appended to YAML files, '%s' is no YAML file", configFile)
+	}
+	entry, err := MarshalProfileEntry(profile)
+	if err != nil {
+		return err
+	}
+	original, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	// the configuration may consist of several files, only the profiles of this one are counted
+	current, err := ReadConfig(configFile)
+	if err != nil {
+		return err
+	}
+	content := append([]byte(nil), original...)
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		content = append(content, '\n')
+	}
+	if current.Profiles == nil {
+		content = append(content, []byte("profiles:\n")...)
+	}
+	content = append(content, entry...)
+
+	info, err := os.Stat(configFile)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(configFile, content, info.Mode()); err != nil {
+		return err
+	}
+	updated, readErr := ReadConfig(configFile)
+	if readErr == nil && updated.Profiles != nil && len(*updated.Profiles) == profileCount(current)+1 {
+		return nil
+	}
+	if err := os.WriteFile(configFile, original, info.Mode()); err != nil {
+		return err
+	}
+	return fmt.Errorf("unable to append the profile to '%s', 'profiles' has to be the last key of the file", configFile)
+}
+
+func profileCount(configuration *YakCtlConfiguration) int {
+	if configuration.Profiles == nil {
+		return 0
+	}
+	return len(*configuration.Profiles)
+}
+
+func changeDirectoryCommand(directory string) string {
+	return "cd " + shellQuote(directory)
+}
+
+// quote a string for the shell if necessary
+func shellQuote(value string) string {
+	if len(value) > 0 && strings.Trim(value, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789/._-+") == "" {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func allEqual(values []string) bool {
+	for _, value := range values {
+		if value != values[0] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTakeSnapshot(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	fake.SetWorkingDirectory(0, "/home/user")
+	protectedID, _ := fake.AddSessionTwoVertical()
+	_ = fake.SetTabTitle(protectedID, "logs")
+	_ = fake.SetSessionClosable(protectedID, false)
+	_ = fake.SetSessionMonitorSilenceEnabled(protectedID, true)
+	fake.SetWorkingDirectory(1, "/var/log")
+	fake.SetWorkingDirectory(2, "/var/log")
+	quadID, _ := fake.AddSessionQuad()
+	_ = fake.SetTabTitle(quadID, "work")
+	_ = fake.SetSessionKeyboardInputEnabled(quadID, false)
+	_ = fake.SetSessionMonitorActivityEnabled(quadID, true)
+	fake.SetWorkingDirectory(3, "/srv/my project")
+	fake.SetWorkingDirectory(5, "/tmp")
+
+	profile, err := TakeSnapshot("snap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &ProfileDescription{
+		Name: "snap",
+		Tabs: []TabDescription{
+			{Name: "Shell No. 1", Workdir: "/home/user"},
+			{Name: "logs", SplitMode: "lr", Workdir: "/var/log", Protected: true, MonitorSilence: true},
+			{
+				Name:                 "work",
+				SplitMode:            "quad",
+				Panes:                []PaneDescription{{Workdir: "/srv/my project"}, {}, {Workdir: "/tmp"}},
+				MonitorActivity:      true,
+				DisableKeyboardInput: true,
+			},
+		},
+	}
+	if !reflect.DeepEqual(profile, expected) {
+		t.Errorf("unexpected snapshot\n%+v\nexpected\n%+v", profile, expected)
+	}
+}
+
+func TestSnapshotOfLoadedProfile(t *testing.T) {
+	newFakeYakuake(t)
+	captureOutput(t)
+	configuration, err := ReadConfig(".yakctl.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadSession(configuration, "default"); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := TakeSnapshot("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original, _ := GetProfile(configuration, "default")
+	if len(profile.Tabs) != len(original.Tabs) {
+		t.Fatalf("expected %d tabs, got %d", len(original.Tabs), len(profile.Tabs))
+	}
+	for i, tab := range profile.Tabs {
+		expected := original.Tabs[i]
+		if tab.Name != expected.Name || tab.Protected != expected.Protected || tab.MonitorSilence != expected.MonitorSilence ||
+			tab.MonitorActivity != expected.MonitorActivity || tab.DisableKeyboardInput != expected.DisableKeyboardInput {
+			t.Errorf("tab %d differs: %+v, expected %+v", i, tab, expected)
+		}
+	}
+}
+
+func TestAppendProfile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), ".yakctl.yml")
+	if err := os.WriteFile(configFile, []byte("# my profiles\nprofiles:\n  - name: first\n    tabs:\n      - name: one"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	configuration, err := ReadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := &ProfileDescription{Name: "snap", Tabs: []TabDescription{{Name: "two", SplitMode: "lr", Protected: true}}}
+
+	if err := AppendProfile(configFile, configuration, profile); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := ReadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*updated.Profiles) != 2 || !reflect.DeepEqual((*updated.Profiles)[1], *profile) {
+		t.Errorf("profile not appended: %+v", *updated.Profiles)
+	}
+	content, _ := os.ReadFile(configFile)
+	if !strings.HasPrefix(string(content), "# my profiles\n") {
+		t.Errorf("existing content should be kept:\n%s", content)
+	}
+
+	if err := AppendProfile(configFile, updated, profile); err == nil {
+		t.Error("expected an error appending a profile with an existing name")
+	}
+}
+
+func TestAppendProfileRestoresFile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), ".yakctl.yml")
+	original := "profiles:\n  - name: first\n    tabs:\n      - name: one\ntemplates: []\n"
+	if err := os.WriteFile(configFile, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	configuration, err := ReadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AppendProfile(configFile, configuration, &ProfileDescription{Name: "snap"}); err == nil {
+		t.Error("expected an error if profiles is not the last key")
+	}
+	if content, _ := os.ReadFile(configFile); string(content) != original {
+		t.Errorf("file was not restored:\n%s", content)
+	}
+}
@@ -0,0 +1,347 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gookit/color"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// SessionStatus is the state of a session (= tab) as printed by 'status --output'
+type SessionStatus struct {
+	ID              int              `json:"id" yaml:"id"`
+	TabIndex        int              `json:"tabIndex" yaml:"tabIndex"`
+	Title           string           `json:"title" yaml:"title"`
+	Active          bool             `json:"active" yaml:"active"`
+	Closable        bool             `json:"closable" yaml:"closable"`
+	MonitorSilence  bool             `json:"monitorSilence" yaml:"monitorSilence"`
+	MonitorActivity bool             `json:"monitorActivity" yaml:"monitorActivity"`
+	KeyboardInput   bool             `json:"keyboardInput" yaml:"keyboardInput"`
+	Terminals       []TerminalStatus `json:"terminals" yaml:"terminals"`
+}
+
+// TerminalStatus is the state of a terminal, process and working directory are empty if konsole does not tell them
+type TerminalStatus struct {
+	ID               int    `json:"id" yaml:"id"`
+	Active           bool   `json:"active" yaml:"active"`
+	ProcessID        int    `json:"pid,omitempty" yaml:"pid,omitempty"`
+	Process          string `json:"process,omitempty" yaml:"process,omitempty"`
+	WorkingDirectory string `json:"cwd,omitempty" yaml:"cwd,omitempty"`
+}
+
+// the output formats of the status, text is a tree of the tabs and their terminals
+var statusFormats = []string{"text", "table", FormatJSON, FormatYAML, "tsv"}
+
+func validStatusFormat(format string) bool {
+	for _, valid := range statusFormats {
+		if format == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// the number of sessions and tabs read at the same time, so the status of many tabs is read fast
+const statusConcurrency = 8
+
+// ReadStatus reads the state of all sessions in tab order
+func ReadStatus() ([]SessionStatus, error) {
+	sessionIDs, err := sessionIDsInTabOrder()
+	if err != nil {
+		return nil, err
+	}
+	activeSessionID, err := yakuake.ActiveSessionID()
+	if err != nil {
+		return nil, err
+	}
+	activeTerminalID, err := yakuake.ActiveTerminalID()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]SessionStatus, len(sessionIDs))
+	err = concurrently(len(sessionIDs), func(index int) error {
+		status, err := readSessionStatus(sessionIDs[index], activeSessionID, activeTerminalID)
+		status.TabIndex = index
+		statuses[index] = status
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+func readSessionStatus(sessionID int, activeSessionID int, activeTerminalID int) (SessionStatus, error) {
+	status := SessionStatus{ID: sessionID, Active: sessionID == activeSessionID, Terminals: []TerminalStatus{}}
+	var err error
+	if status.Title, err = yakuake.TabTitle(sessionID); err != nil {
+		return status, err
+	}
+	if status.Closable, err = yakuake.IsSessionClosable(sessionID); err != nil {
+		return status, err
+	}
+	if status.MonitorSilence, err = yakuake.IsSessionMonitorSilenceEnabled(sessionID); err != nil {
+		return status, err
+	}
+	if status.MonitorActivity, err = yakuake.IsSessionMonitorActivityEnabled(sessionID); err != nil {
+		return status, err
+	}
+	if status.KeyboardInput, err = yakuake.IsSessionKeyboardInputEnabled(sessionID); err != nil {
+		return status, err
+	}
+	terminalIDs, err := yakuake.TerminalIDsForSessionID(sessionID)
+	if err != nil {
+		return status, err
+	}
+	for _, terminalID := range terminalIDs {
+		terminal := TerminalStatus{ID: terminalID, Active: status.Active && terminalID == activeTerminalID}
+		// konsole does not expose the processes in every setup
+		if pid, name, processErr := yakuake.TerminalForegroundProcess(terminalID); processErr == nil {
+			terminal.ProcessID, terminal.Process = pid, name
+		}
+		if directory, dirErr := yakuake.TerminalWorkingDirectory(terminalID); dirErr == nil {
+			terminal.WorkingDirectory = directory
+		}
+		status.Terminals = append(status.Terminals, terminal)
+	}
+	return status, nil
+}
+
+// the ids of all sessions in the order of their tabs, sessions yakuake does not show as tab are appended
+func sessionIDsInTabOrder() ([]int, error) {
+	sessionIDs, err := getAllSessionIDs()
+	if err != nil {
+		return nil, err
+	}
+	tabs := make([]int, len(sessionIDs))
+	err = concurrently(len(sessionIDs), func(index int) error {
+		var tabErr error
+		tabs[index], tabErr = yakuake.SessionAtTab(index)
+		return tabErr
+	})
+	if err != nil {
+		return nil, err
+	}
+	var ordered []int
+	known := map[int]bool{}
+	for _, sessionID := range tabs {
+		if sessionID >= 0 && !known[sessionID] {
+			ordered = append(ordered, sessionID)
+			known[sessionID] = true
+		}
+	}
+	for _, sessionID := range sessionIDs {
+		if !known[sessionID] {
+			ordered = append(ordered, sessionID)
+		}
+	}
+	return ordered, nil
+}
+
+// call read for the indexes 0 to count-1, at most statusConcurrency at the same time, and return the first error
+func concurrently(count int, read func(index int) error) error {
+	errs := make([]error, count)
+	limit := make(chan struct{}, statusConcurrency)
+	var wg sync.WaitGroup
+	for index := 0; index < count; index++ {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func() {
+			defer wg.Done()
+			errs[index] = read(index)
+			<-limit
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ShowStatus prints the state of all sessions as tree ('text'), table or in json, yaml or tsv format
+func ShowStatus(format string) error {
+	statuses, err := ReadStatus()
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "text":
+		printStatusTree(statuses)
+	case "table":
+		printStatusTable(statuses)
+	default:
+		output, err := formatStatus(statuses, format)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(output))
+	}
+	return nil
+}
+
+// WatchStatus prints the status again and again, replacing the previous one, until yakctl is interrupted
+func WatchStatus(format string, interval time.Duration) error {
+	if !validStatusFormat(format) {
+		return fmt.Errorf("invalid output format '%s', valid formats: %s", format, strings.Join(statusFormats, ", "))
+	}
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %v, the interval has to be positive", interval)
+	}
+	for {
+		// move the cursor home and clear the screen
+		fmt.Print("\033[H\033[2J")
+		if err := ShowStatus(format); err != nil {
+			color.Error.Println(err)
+		}
+		color.Normal.Printf("\nEvery %v, %s - press Ctrl+C to stop\n", interval, time.Now().Format("15:04:05"))
+		time.Sleep(interval)
+	}
+}
+
+// a session per line, marked with '*' if active, followed by its terminals
+func printStatusTree(statuses []SessionStatus) {
+	for _, status := range statuses {
+		line := fmt.Sprintf("%s [%d] session #%d, tab title: %s (%s)", activeMarker(status.Active), status.TabIndex, status.ID, status.Title, statusShape(status))
+		for _, badge := range statusBadges(status) {
+			line += " [" + badge + "]"
+		}
+		if status.Active {
+			color.Success.Println(line)
+		} else {
+			color.Info.Println(line)
+		}
+		for _, terminal := range status.Terminals {
+			color.Info.Printf("\t|- Terminal #%d%s%s\n", terminal.ID, activeMarker(terminal.Active), terminalDetails(terminal))
+		}
+	}
+}
+
+// a line per terminal, the columns of its session are only filled in for the first terminal
+func printStatusTable(statuses []SessionStatus) {
+	var buf bytes.Buffer
+	writer := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "TAB\tSESSION\tTITLE\tLAYOUT\tFLAGS\tTERMINAL\tPROCESS\tCWD")
+	for _, status := range statuses {
+		session := fmt.Sprintf("%d\t%d%s\t%s\t%s\t%s", status.TabIndex, status.ID, activeMarker(status.Active),
+			strings.Join(strings.Fields(status.Title), " "), statusShape(status), strings.Join(statusBadges(status), ","))
+		if len(status.Terminals) == 0 {
+			_, _ = fmt.Fprintf(writer, "%s\t\t\t\n", session)
+		}
+		for i, terminal := range status.Terminals {
+			if i > 0 {
+				session = "\t\t\t\t"
+			}
+			_, _ = fmt.Fprintf(writer, "%s\t%d%s\t%s\t%s\n", session, terminal.ID, activeMarker(terminal.Active), terminal.Process, terminal.WorkingDirectory)
+		}
+	}
+	_ = writer.Flush()
+	color.Info.Print(buf.String())
+}
+
+func activeMarker(active bool) string {
+	if active {
+		return "*"
+	}
+	return " "
+}
+
+// yakuake does not tell the direction of splits, only the number of terminals is known
+func statusShape(status SessionStatus) string {
+	if len(status.Terminals) <= 1 {
+		return "single"
+	}
+	return fmt.Sprintf("split in %d", len(status.Terminals))
+}
+
+func statusBadges(status SessionStatus) []string {
+	var badges []string
+	if !status.Closable {
+		badges = append(badges, "protected")
+	}
+	if status.MonitorSilence {
+		badges = append(badges, "monitor silence")
+	}
+	if status.MonitorActivity {
+		badges = append(badges, "monitor activity")
+	}
+	if !status.KeyboardInput {
+		badges = append(badges, "input disabled")
+	}
+	return badges
+}
+
+func terminalDetails(terminal TerminalStatus) string {
+	details := ""
+	if len(terminal.Process) > 0 {
+		details += " " + terminal.Process
+	}
+	if len(terminal.WorkingDirectory) > 0 {
+		details += " in " + terminal.WorkingDirectory
+	}
+	return details
+}
+
+func formatStatus(statuses []SessionStatus, format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		output, err := json.MarshalIndent(statuses, "", "  ")
+		return append(output, '\n'), err
+	case FormatYAML:
+		return marshalYAML(statuses)
+	case "tsv":
+		return []byte(statusTSV(statuses)), nil
+	default:
+		return nil, fmt.Errorf("invalid output format '%s', valid formats: %s", format, strings.Join(statusFormats, ", "))
+	}
+}
+
+// one line per terminal with the state of its session, tabs and line breaks of titles are replaced by spaces
+func statusTSV(statuses []SessionStatus) string {
+	lines := []string{"session\ttab\ttitle\tactive\tclosable\tmonitorSilence\tmonitorActivity\tkeyboardInput\tterminal\tpid\tprocess\tcwd"}
+	for _, status := range statuses {
+		session := []string{
+			strconv.Itoa(status.ID), strconv.Itoa(status.TabIndex), strings.Join(strings.Fields(status.Title), " "),
+			strconv.FormatBool(status.Active), strconv.FormatBool(status.Closable), strconv.FormatBool(status.MonitorSilence),
+			strconv.FormatBool(status.MonitorActivity), strconv.FormatBool(status.KeyboardInput),
+		}
+		if len(status.Terminals) == 0 {
+			lines = append(lines, strings.Join(append(session, "", "", "", ""), "\t"))
+		}
+		for _, terminal := range status.Terminals {
+			pid := ""
+			if terminal.ProcessID > 0 {
+				pid = strconv.Itoa(terminal.ProcessID)
+			}
+			fields := append(append([]string(nil), session...), strconv.Itoa(terminal.ID), pid, terminal.Process, terminal.WorkingDirectory)
+			lines = append(lines, strings.Join(fields, "\t"))
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,174 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadStatus(t *testing.T) {
+	fake := newFakeYakuake(t)
+	logsID, _ := fake.AddSessionTwoHorizontal()
+	_ = fake.SetTabTitle(logsID, "logs")
+	_ = fake.SetSessionClosable(logsID, false)
+	_ = fake.SetSessionMonitorActivityEnabled(logsID, true)
+	fake.SetWorkingDirectory(1, "/var/log")
+	fake.KeepRunning("tail")
+	_ = fake.RunCommandInTerminal(1, "tail -f syslog")
+	fake.MoveTab(logsID, 0)
+	fake.SetActiveTerminal(0)
+
+	statuses, err := ReadStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SessionStatus{
+		{ID: 1, TabIndex: 0, Title: "logs", MonitorActivity: true, KeyboardInput: true, Terminals: []TerminalStatus{
+			{ID: 1, ProcessID: 1003, Process: "tail", WorkingDirectory: "/var/log"},
+			{ID: 2, ProcessID: 1002, Process: "bash"},
+		}},
+		{ID: 0, TabIndex: 1, Title: "Shell No. 1", Active: true, Closable: true, KeyboardInput: true, Terminals: []TerminalStatus{
+			{ID: 0, Active: true, ProcessID: 1000, Process: "bash"},
+		}},
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("unexpected status\n%+v\nexpected\n%+v", statuses, expected)
+	}
+}
+
+func TestShowStatus(t *testing.T) {
+	fake := newFakeYakuake(t)
+	output := captureOutput(t)
+	sessionID, _ := fake.AddSessionTwoVertical()
+	_ = fake.SetTabTitle(sessionID, "logs")
+	_ = fake.SetSessionClosable(sessionID, false)
+	_ = fake.SetSessionKeyboardInputEnabled(sessionID, false)
+	fake.SetActiveTerminal(2)
+	fake.SetWorkingDirectory(2, "/var/log")
+
+	if err := ShowStatus("text"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"  [0] session #0, tab title: Shell No. 1 (single)",
+		"* [1] session #1, tab title: logs (split in 2) [protected] [input disabled]",
+		"|- Terminal #1  bash",
+		"|- Terminal #2* bash in /var/log",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("missing '%s' in output:\n%s", expected, output)
+		}
+	}
+
+	output.Reset()
+	if err := ShowStatus("table"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"TAB  SESSION  TITLE        LAYOUT      FLAGS                     TERMINAL  PROCESS  CWD\n",
+		"0    0        Shell No. 1  single                                0         bash",
+		"1    1*       logs         split in 2  protected,input disabled  1         bash",
+		"  2*        bash     /var/log\n",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("missing '%s' in output:\n%s", expected, output)
+		}
+	}
+
+	if err := ShowStatus("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestReadStatusManyTabs(t *testing.T) {
+	fake := newFakeYakuake(t)
+	for i := 0; i < 40; i++ {
+		_, _ = fake.AddSessionQuad()
+	}
+	fake.MoveTab(40, 0)
+
+	statuses, err := ReadStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 41 || statuses[0].ID != 40 || statuses[1].ID != 0 || statuses[40].ID != 39 {
+		t.Fatalf("sessions are not in tab order: %+v", statuses)
+	}
+	for i, status := range statuses {
+		if status.TabIndex != i || len(status.Terminals) != 1 && len(status.Terminals) != 4 {
+			t.Errorf("unexpected status %+v", status)
+		}
+	}
+}
+
+func TestFormatStatus(t *testing.T) {
+	statuses := []SessionStatus{
+		{ID: 3, TabIndex: 0, Title: "my\ttab", Active: true, Closable: true, KeyboardInput: true, Terminals: []TerminalStatus{
+			{ID: 5, ProcessID: 42, Process: "zsh", WorkingDirectory: "/home/user"},
+			{ID: 6},
+		}},
+	}
+
+	tsv, err := formatStatus(statuses, "tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTSV := "session\ttab\ttitle\tactive\tclosable\tmonitorSilence\tmonitorActivity\tkeyboardInput\tterminal\tpid\tprocess\tcwd\n" +
+		"3\t0\tmy tab\ttrue\ttrue\tfalse\tfalse\ttrue\t5\t42\tzsh\t/home/user\n" +
+		"3\t0\tmy tab\ttrue\ttrue\tfalse\tfalse\ttrue\t6\t\t\t\n"
+	if string(tsv) != expectedTSV {
+		t.Errorf("unexpected tsv output\n%q\nexpected\n%q", tsv, expectedTSV)
+	}
+
+	for _, format := range []string{FormatJSON, FormatYAML} {
+		output, err := formatStatus(statuses, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var parsed []SessionStatus
+		if format == FormatJSON {
+			err = json.Unmarshal(output, &parsed)
+		} else {
+			err = yaml.Unmarshal(output, &parsed)
+		}
+		if err != nil || !reflect.DeepEqual(parsed, statuses) {
+			t.Errorf("%s output does not describe the status: %v\n%s", format, err, output)
+		}
+	}
+
+	if _, err := formatStatus(statuses, "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestWatchStatusInvalidInterval(t *testing.T) {
+	newFakeYakuake(t)
+	captureOutput(t)
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if err := WatchStatus("text", interval); err == nil {
+			t.Errorf("expected an error for the interval %v", interval)
+		}
+	}
+}
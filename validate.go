@@ -0,0 +1,362 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// structs which may also be given as text
+var textForms = map[reflect.Type]bool{
+	reflect.TypeOf(Command{}): true,
+}
+
+// names of environment variables a shell can export
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// configProblems lists everything wrong with a configuration, each entry starting with file:line:column
+type configProblems []string
+
+func (p configProblems) Error() string {
+	return strings.Join(p, "\n")
+}
+
+// configValidator collects the problems of a configuration
+type configValidator struct {
+	sources  sourceMap
+	problems configProblems
+}
+
+func (v *configValidator) report(node *yaml.Node, format string, args ...interface{}) {
+	problem := v.sources.position(node) + ": " + fmt.Sprintf(format, args...)
+	// inherited tabs and templates are checked once per use
+	for _, existing := range v.problems {
+		if existing == problem {
+			return
+		}
+	}
+	v.problems = append(v.problems, problem)
+}
+
+// checkFields reports keys unknown to the configuration structs and values of the wrong kind
+func (v *configValidator) checkFields(node *yaml.Node, valueType reflect.Type) {
+	if node == nil {
+		return
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	switch valueType.Kind() {
+	case reflect.Struct:
+		if node.Kind == yaml.ScalarNode && textForms[valueType] {
+			return
+		}
+		if node.Kind != yaml.MappingNode {
+			v.report(node, "expected a mapping of keys and values")
+			return
+		}
+		fields := yamlFields(valueType)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			field, known := fields[key.Value]
+			if !known {
+				v.report(key, "unknown key '%s'", key.Value)
+				continue
+			}
+			v.checkFields(node.Content[i+1], field.Type)
+		}
+		if valueType == reflect.TypeOf(Command{}) {
+			v.checkCommand(node)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			v.report(node, "expected a list")
+			return
+		}
+		for _, item := range node.Content {
+			v.checkFields(item, valueType.Elem())
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.report(node, "expected a mapping of keys and values")
+			return
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			v.checkFields(node.Content[i], valueType.Elem())
+		}
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			v.report(node, "expected true or false, got '%s'", node.Value)
+		}
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			v.report(node, "expected a text")
+		}
+	case reflect.Int:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			v.report(node, "expected a number, got '%s'", node.Value)
+		}
+	}
+}
+
+// yamlField is a field of a configuration struct, Owner is the struct declaring it, which differs for inlined structs
+type yamlField struct {
+	reflect.StructField
+	Owner reflect.Type
+}
+
+// the fields of a struct by their yaml key, including the fields of inlined structs
+func yamlFields(structType reflect.Type) map[string]yamlField {
+	fields := map[string]yamlField{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		options := strings.Split(field.Tag.Get("yaml"), ",")
+		name := options[0]
+		if name == "-" {
+			continue
+		}
+		if len(options) > 1 && options[1] == "inline" {
+			for key, inlined := range yamlFields(field.Type) {
+				fields[key] = inlined
+			}
+			continue
+		}
+		if len(name) == 0 {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = yamlField{StructField: field, Owner: structType}
+	}
+	return fields
+}
+
+// checkProfiles reports problems of the resolved profiles: missing and duplicate names, invalid splits
+func (v *configValidator) checkProfiles(root *yaml.Node) {
+	profiles := mappingValue(root, "profiles")
+	if profiles == nil {
+		return
+	}
+	names := map[string]*yaml.Node{}
+	for _, profile := range profiles.Content {
+		nameNode := mappingValue(profile, "name")
+		switch {
+		case nameNode == nil || len(strings.TrimSpace(nameNode.Value)) == 0:
+			v.report(profile, "profile without name")
+		case names[nameNode.Value] != nil:
+			v.report(nameNode, "profile '%s' is already defined at %s", nameNode.Value, v.sources.position(names[nameNode.Value]))
+		default:
+			names[nameNode.Value] = nameNode
+		}
+		if tabs := mappingValue(profile, "tabs"); tabs != nil {
+			for _, tab := range tabs.Content {
+				v.checkTab(tab)
+			}
+		}
+	}
+}
+
+func (v *configValidator) checkTab(tab *yaml.Node) {
+	if nameNode := mappingValue(tab, "name"); nameNode == nil || len(strings.TrimSpace(nameNode.Value)) == 0 {
+		v.report(tab, "tab without name")
+	}
+	v.checkEnvironment(tab)
+	if panes := mappingValue(tab, "panes"); panes != nil {
+		for _, pane := range panes.Content {
+			v.checkEnvironment(pane)
+		}
+	}
+	if layout := mappingValue(tab, "layout"); layout != nil {
+		for i := 0; i+1 < len(tab.Content); i += 2 {
+			if key := tab.Content[i]; key.Value == "split" || key.Value == "panes" || strings.HasPrefix(key.Value, "terminal") {
+				v.report(key, "'%s' can't be combined with 'layout', the layout describes all panes", key.Value)
+			}
+		}
+		v.checkLayout(layout)
+		return
+	}
+	split := ""
+	if splitNode := mappingValue(tab, "split"); splitNode != nil {
+		split = splitNode.Value
+		if _, valid := splitModeTerminals[strings.ToLower(split)]; !valid {
+			v.report(splitNode, "invalid split '%s', valid splits: lr, tb, quad", split)
+			return
+		}
+	}
+	terminals := splitModeTerminals[strings.ToLower(split)]
+	for i := 0; i+1 < len(tab.Content); i += 2 {
+		key := tab.Content[i]
+		var number int
+		if _, err := fmt.Sscanf(key.Value, "terminal%d", &number); err != nil || number <= terminals {
+			continue
+		}
+		if len(split) == 0 {
+			v.report(key, "'%s' needs a split, a tab without split has a single terminal", key.Value)
+		} else {
+			v.report(key, "'%s' is not available with split '%s', which has %d terminals", key.Value, split, terminals)
+		}
+	}
+}
+
+// a layout needs a valid split for its children, which are at least two
+func (v *configValidator) checkLayout(layout *yaml.Node) {
+	v.checkEnvironment(layout)
+	splitNode := mappingValue(layout, "split")
+	children := mappingValue(layout, "children")
+	if sizeNode := mappingValue(layout, "size"); sizeNode != nil && strings.HasPrefix(sizeNode.Value, "-") {
+		v.report(sizeNode, "the size of a pane has to be positive")
+	}
+	if children == nil || len(children.Content) == 0 {
+		if splitNode != nil {
+			v.report(splitNode, "a split needs 'children'")
+		}
+		return
+	}
+	if splitNode == nil {
+		v.report(children, "panes with 'children' need a 'split': lr or tb")
+	} else if _, valid := layoutSplits[strings.ToLower(splitNode.Value)]; !valid {
+		v.report(splitNode, "invalid split '%s' of a layout, valid splits: lr, tb", splitNode.Value)
+	}
+	if len(children.Content) < 2 {
+		v.report(children, "a split needs at least two children")
+	}
+	if commands := mappingValue(layout, "commands"); commands != nil {
+		v.report(commands, "panes with 'children' have no commands, the commands belong to the children")
+	}
+	for _, child := range children.Content {
+		v.checkLayout(child)
+	}
+}
+
+// a command given as mapping needs either the command to run or the keys to send, and valid options
+func (v *configValidator) checkCommand(command *yaml.Node) {
+	run, sendKeys := mappingValue(command, "run"), mappingValue(command, "sendKeys")
+	switch {
+	case run != nil && sendKeys != nil:
+		v.report(sendKeys, "'sendKeys' can't be combined with 'run'")
+	case sendKeys != nil:
+		if len(sendKeys.Value) == 0 {
+			v.report(sendKeys, "'sendKeys' without text")
+		}
+	case run == nil || len(strings.TrimSpace(run.Value)) == 0:
+		v.report(command, "command without 'run' or 'sendKeys'")
+	}
+	if retry := mappingValue(command, "retry"); retry != nil {
+		if strings.HasPrefix(retry.Value, "-") {
+			v.report(retry, "the number of retries has to be positive")
+		} else if mappingValue(command, "expect") == nil {
+			v.report(retry, "'retry' needs 'expect', a command is repeated if the expected text does not appear")
+		}
+	}
+	if delayNode := mappingValue(command, "delay"); delayNode != nil {
+		if delay, err := time.ParseDuration(delayNode.Value); err != nil || delay < 0 {
+			v.report(delayNode, "invalid delay '%s', expected a duration like 500ms or 2s", delayNode.Value)
+		}
+	}
+}
+
+// the environment variables of a tab or pane need valid names. Working directories are checked by checkWorkdirs
+// when a profile is opened, they may not exist on every machine the configuration is used on.
+func (v *configValidator) checkEnvironment(node *yaml.Node) {
+	if env := mappingValue(node, "env"); env != nil && env.Kind == yaml.MappingNode {
+		for i := 0; i < len(env.Content); i += 2 {
+			if name := env.Content[i]; !envNamePattern.MatchString(name.Value) {
+				v.report(name, "invalid name of an environment variable '%s'", name.Value)
+			}
+		}
+	}
+}
+
+// checkWorkdirs reports working directories of the tabs and panes of a rendered profile which don't exist
+func checkWorkdirs(profile *ProfileDescription) error {
+	var problems []string
+	check := func(tab *TabDescription, workdir string) {
+		if len(workdir) == 0 || strings.Contains(workdir, "{{") {
+			return
+		}
+		directory := expandValue(workdir)
+		if info, err := os.Stat(directory); err != nil {
+			problems = append(problems, fmt.Sprintf("working directory '%s' of tab '%s' does not exist", directory, tab.Name))
+		} else if !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("working directory '%s' of tab '%s' is not a directory", directory, tab.Name))
+		}
+	}
+	var checkLayout func(tab *TabDescription, layout *LayoutDescription)
+	checkLayout = func(tab *TabDescription, layout *LayoutDescription) {
+		check(tab, layout.Workdir)
+		for i := range layout.Children {
+			checkLayout(tab, &layout.Children[i])
+		}
+	}
+	for i := range profile.Tabs {
+		tab := &profile.Tabs[i]
+		check(tab, tab.Workdir)
+		for _, pane := range tab.Panes {
+			check(tab, pane.Workdir)
+		}
+		if tab.Layout != nil {
+			checkLayout(tab, tab.Layout)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("profile '%s': %s", profile.Name, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// ValidateConfiguration reads configuration files and prints all problems found
+func ValidateConfiguration(files []ConfigSource) bool {
+	configuration, err := ReadConfigFiles(files)
+	if problems, ok := err.(configProblems); ok {
+		for _, problem := range problems {
+			color.Error.Println(problem)
+		}
+		color.Error.Printf("%d problem(s) found\n", len(problems))
+		return false
+	}
+	if err != nil {
+		color.Error.Println(err)
+		return false
+	}
+	// missing working directories are no error of the configuration, they may exist on other machines only
+	for i := range *configuration.Profiles {
+		if profile, err := getRenderedProfile(configuration, (*configuration.Profiles)[i].Name, nil); err == nil {
+			if err := checkWorkdirs(profile); err != nil {
+				color.Warn.Println(err)
+			}
+		}
+	}
+	if legacy, userFile := ignoredLegacyConfig(files); len(legacy) > 0 {
+		color.Warn.Printf("%s is ignored, because %s exists. Move its profiles to %s.\n", legacy, userFile, userFile)
+	}
+	color.Success.Printf("Configuration is valid: %d profile(s) in %d file(s)\n", profileCount(configuration), len(configuration.Sources))
+	return true
+}
@@ -0,0 +1,202 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConfigValidation(t *testing.T) {
+	content := `profiles:
+  - name: work
+    tabs:
+      - name: a
+        split: quadd
+      - name: b
+        split: lr
+        terminal3:
+          - top
+      - name: c
+        terminal5:
+          - top
+        protected: yes
+      - name: ""
+        terminal2: []
+  - name: work
+templates:
+  - name: t
+    comands:
+      - ls
+`
+	dir := writeConfigFiles(t, map[string]string{".yakctl.yml": content})
+	file := filepath.Join(dir, ".yakctl.yml")
+
+	_, err := ReadConfig(file)
+	problems, ok := err.(configProblems)
+	if !ok {
+		t.Fatalf("expected configuration problems, got %v", err)
+	}
+	expected := []string{
+		file + ":11:9: unknown key 'terminal5'",
+		file + ":13:20: expected true or false, got 'yes'",
+		file + ":19:5: unknown key 'comands'",
+	}
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected problems\n%v\nexpected\n%v", problems, strings.Join(expected, "\n"))
+	}
+
+	// values are checked once all keys are known
+	content = strings.Replace(content, "        terminal5:\n          - top\n        protected: yes\n", "", 1)
+	content = strings.Replace(content, "comands", "commands", 1)
+	dir = writeConfigFiles(t, map[string]string{".yakctl.yml": content})
+	file = filepath.Join(dir, ".yakctl.yml")
+	_, err = ReadConfig(file)
+	expected = []string{
+		file + ":5:16: invalid split 'quadd', valid splits: lr, tb, quad",
+		file + ":8:9: 'terminal3' is not available with split 'lr', which has 2 terminals",
+		file + ":11:9: tab without name",
+		file + ":12:9: 'terminal2' needs a split, a tab without split has a single terminal",
+		file + ":13:11: profile 'work' is already defined at " + file + ":2:11",
+	}
+	if err == nil || err.Error() != strings.Join(expected, "\n") {
+		t.Errorf("unexpected problems\n%v\nexpected\n%v", err, strings.Join(expected, "\n"))
+	}
+}
+
+func TestReadConfigEnvironmentValidation(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		".yakctl.yml": "profiles:\n  - name: work\n    tabs:\n      - name: a\n        workdir: /does/not/exist\n        env:\n          1NVALID: x\n",
+	})
+	_, err := ReadConfig(filepath.Join(dir, ".yakctl.yml"))
+	problems, ok := err.(configProblems)
+	if !ok {
+		t.Fatalf("expected problems, got %v", err)
+	}
+	// missing working directories are checked when the profile is opened
+	if len(problems) != 1 || !strings.HasSuffix(problems[0], ":7:11: invalid name of an environment variable '1NVALID'") {
+		t.Errorf("unexpected problems %v", problems)
+	}
+}
+
+func TestCheckWorkdirs(t *testing.T) {
+	fake := newFakeYakuake(t)
+	dir := writeConfigFiles(t, map[string]string{
+		".yakctl.yml": "profiles:\n  - name: work\n    tabs:\n      - name: a\n        workdir: /does/not/exist\n" +
+			"  - name: notes\n    vars:\n      file: notes.txt\n    tabs:\n      - name: b\n        layout:\n          workdir: \"{{ .file }}\"\n" +
+			"  - name: home\n    tabs:\n      - name: c\n        workdir: .\n",
+		"notes.txt": "not a directory",
+	})
+	configuration, err := ReadConfig(filepath.Join(dir, ".yakctl.yml"))
+	if err != nil {
+		t.Fatalf("a missing working directory should not fail reading the configuration: %v", err)
+	}
+	buf := captureOutput(t)
+
+	if err := LoadSession(configuration, "work"); err == nil || !strings.Contains(err.Error(), "working directory '/does/not/exist' of tab 'a' does not exist") {
+		t.Errorf("expected a missing working directory, got %v", err)
+	}
+	// working directories containing variables are resolved against the file of the profile after rendering
+	expected := "working directory '" + filepath.Join(dir, "notes.txt") + "' of tab 'b' is not a directory"
+	if err := ApplyProfile(configuration, "notes", nil, false, false); err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected a working directory which is no directory, got %v", err)
+	}
+	if sessions := fake.Sessions(); len(sessions) != 1 {
+		t.Errorf("no tab should be opened:\n%s", fake)
+	}
+	if err := LoadSession(configuration, "home"); err != nil {
+		t.Errorf("profiles with existing working directories should be opened: %v", err)
+	}
+
+	buf.Reset()
+	if !ValidateConfiguration([]ConfigSource{{File: filepath.Join(dir, ".yakctl.yml")}}) || !strings.Contains(buf.String(), "'/does/not/exist' of tab 'a' does not exist") {
+		t.Errorf("expected a warning about the missing working directory:\n%s", buf.String())
+	}
+}
+
+func TestReadConfigRelativeWorkdir(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"project/.yakctl.yml": "profiles:\n  - name: work\n    tabs:\n      - name: a\n        workdir: src\n        panes:\n          - workdir: ../docs\n",
+		"project/src/main.go": "package main\n",
+		"docs/index.md":       "# docs\n",
+	})
+	t.Chdir(t.TempDir())
+
+	configuration, err := ReadConfig(filepath.Join(dir, "project", ".yakctl.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab := (*configuration.Profiles)[0].Tabs[0]
+	if expected := filepath.Join(dir, "project", "src"); tab.Workdir != expected {
+		t.Errorf("expected the working directory %s relative to the configuration file, got %s", expected, tab.Workdir)
+	}
+	if expected := filepath.Join(dir, "docs"); tab.Panes[0].Workdir != expected {
+		t.Errorf("expected the working directory %s of the pane, got %s", expected, tab.Panes[0].Workdir)
+	}
+}
+
+func TestReadConfigCommandValidation(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		".yakctl.yml": "profiles:\n  - name: work\n    tabs:\n      - name: a\n        commands:\n          - ls\n          - delay: 2s\n          - run: uptime\n            delay: soon\n          - run: ls\n            sendKeys: q\n            retry: 2\n",
+	})
+	_, err := ReadConfig(filepath.Join(dir, ".yakctl.yml"))
+	problems, ok := err.(configProblems)
+	if !ok {
+		t.Fatalf("expected problems, got %v", err)
+	}
+	expected := []string{
+		":7:13: command without 'run' or 'sendKeys'",
+		":9:20: invalid delay 'soon', expected a duration like 500ms or 2s",
+		":11:23: 'sendKeys' can't be combined with 'run'",
+		":12:20: 'retry' needs 'expect', a command is repeated if the expected text does not appear",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+	for i, problem := range problems {
+		if !strings.HasSuffix(problem, expected[i]) {
+			t.Errorf("unexpected problem %q, expected %q", problem, expected[i])
+		}
+	}
+}
+
+func TestValidateConfiguration(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"valid.yml":   "profiles:\n  - name: work\n    tabs:\n      - name: quad\n        split: QUAD\n        terminal4: [top]\n",
+		"invalid.yml": "profiles:\n  - name: work\n    tab: []\n",
+	})
+
+	buf := captureOutput(t)
+	if !ValidateConfiguration([]ConfigSource{{File: filepath.Join(dir, "valid.yml"), Origin: ConfigOriginFlag}}) {
+		t.Errorf("expected a valid configuration, got\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "Configuration is valid: 1 profile(s) in 1 file(s)") {
+		t.Errorf("unexpected output\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if ValidateConfiguration([]ConfigSource{{File: filepath.Join(dir, "invalid.yml"), Origin: ConfigOriginFlag}}) {
+		t.Error("expected an invalid configuration")
+	}
+	if !strings.Contains(buf.String(), "invalid.yml:3:5: unknown key 'tab'") || !strings.Contains(buf.String(), "1 problem(s) found") {
+		t.Errorf("unexpected output\n%s", buf.String())
+	}
+}
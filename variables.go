@@ -0,0 +1,209 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// RenderProfile returns a copy of the profile with its variables filled into tab names and commands using text/template.
+// Only profiles declaring vars are rendered, so commands of other profiles may contain '{{' as they are.
+// Values of variables may refer to environment variables like $HOME.
+func RenderProfile(profile *ProfileDescription, overrides map[string]string) (*ProfileDescription, error) {
+	return renderProfile(profile, overrides, "")
+}
+
+// render a profile, relative working directories containing variables are resolved against dir
+func renderProfile(profile *ProfileDescription, overrides map[string]string, dir string) (*ProfileDescription, error) {
+	if profile.Vars == nil {
+		return profile, nil
+	}
+	values := map[string]string{}
+	var missing []string
+	for name, defaultValue := range profile.Vars {
+		if value, ok := overrides[name]; ok {
+			values[name] = os.ExpandEnv(value)
+		} else if defaultValue != nil {
+			values[name] = os.ExpandEnv(*defaultValue)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("profile '%s' requires the variable(s) %s, set them with --set name=value", profile.Name, strings.Join(missing, ", "))
+	}
+
+	renderer := &templateRenderer{profile: profile.Name, values: values, dir: dir}
+	rendered := *profile
+	rendered.Tabs = make([]TabDescription, len(profile.Tabs))
+	for i, tab := range profile.Tabs {
+		renderer.tab = tab.Name
+		tab.Name = renderer.render(tab.Name)
+		tab.Workdir = renderer.renderWorkdir(tab.Workdir)
+		tab.Env = renderer.renderEnv(tab.Env)
+		tab.Commands = renderer.renderCommands(tab.Commands)
+		tab.Terminal1 = renderer.renderCommands(tab.Terminal1)
+		tab.Terminal2 = renderer.renderCommands(tab.Terminal2)
+		tab.Terminal3 = renderer.renderCommands(tab.Terminal3)
+		tab.Terminal4 = renderer.renderCommands(tab.Terminal4)
+		tab.Layout = renderer.renderLayout(tab.Layout)
+		var panes []PaneDescription
+		for _, pane := range tab.Panes {
+			panes = append(panes, renderer.renderPane(pane))
+		}
+		tab.Panes = panes
+		if renderer.err != nil {
+			return nil, renderer.err
+		}
+		rendered.Tabs[i] = tab
+	}
+	return &rendered, nil
+}
+
+// parse variables given as name=value
+func parseVariables(assignments []string) (map[string]string, error) {
+	variables := map[string]string{}
+	for _, assignment := range assignments {
+		name, value, found := strings.Cut(assignment, "=")
+		name = strings.TrimSpace(name)
+		if !found || len(name) == 0 {
+			return nil, fmt.Errorf("invalid variable '%s', expected name=value", assignment)
+		}
+		variables[name] = value
+	}
+	return variables, nil
+}
+
+// check that all variables given are declared by at least one of the profiles
+func checkVariablesDeclared(profiles []*ProfileDescription, variables map[string]string) error {
+	var names []string
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		declared := false
+		for _, profile := range profiles {
+			if _, ok := profile.Vars[name]; ok {
+				declared = true
+				break
+			}
+		}
+		if !declared {
+			return fmt.Errorf("variable '%s' is not declared in the vars of the profile(s)", name)
+		}
+	}
+	return nil
+}
+
+// renders strings of a tab, the first error is kept
+type templateRenderer struct {
+	profile string
+	tab     string
+	values  map[string]string
+	err     error
+	// directory of the file of the profile, relative working directories are resolved against it
+	dir string
+}
+
+func (r *templateRenderer) render(text string) string {
+	if r.err != nil || !strings.Contains(text, "{{") {
+		return text
+	}
+	tmpl, err := template.New(r.tab).Option("missingkey=error").Funcs(template.FuncMap{
+		"env": os.Getenv,
+	}).Parse(text)
+	if err != nil {
+		r.err = fmt.Errorf("invalid template in tab '%s' of profile '%s': %v", r.tab, r.profile, err)
+		return text
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, r.values); err != nil {
+		r.err = fmt.Errorf("problem rendering tab '%s' of profile '%s': %v", r.tab, r.profile, err)
+		return text
+	}
+	return buf.String()
+}
+
+// a rendered working directory, relative to the file of the profile if it contained variables
+func (r *templateRenderer) renderWorkdir(workdir string) string {
+	if !strings.Contains(workdir, "{{") {
+		return workdir
+	}
+	return resolveWorkdir(r.render(workdir), r.dir)
+}
+
+// copy of commands with all texts of the commands rendered
+func (r *templateRenderer) renderCommands(commands []Command) []Command {
+	if commands == nil {
+		return nil
+	}
+	rendered := make([]Command, len(commands))
+	for i, command := range commands {
+		command.Run = r.render(command.Run)
+		command.SendKeys = r.render(command.SendKeys)
+		command.If = r.render(command.If)
+		command.WaitFor = r.render(command.WaitFor)
+		command.Expect = r.render(command.Expect)
+		rendered[i] = command
+	}
+	return rendered
+}
+
+// copy of a layout with the commands of all panes rendered
+func (r *templateRenderer) renderLayout(layout *LayoutDescription) *LayoutDescription {
+	if layout == nil {
+		return nil
+	}
+	rendered := *layout
+	rendered.PaneDescription = r.renderPane(layout.PaneDescription)
+	rendered.Children = nil
+	for i := range layout.Children {
+		rendered.Children = append(rendered.Children, *r.renderLayout(&layout.Children[i]))
+	}
+	return &rendered
+}
+
+// copy of a pane with its name, commands, working directory and environment rendered
+func (r *templateRenderer) renderPane(pane PaneDescription) PaneDescription {
+	pane.Name = r.render(pane.Name)
+	pane.Commands = r.renderCommands(pane.Commands)
+	pane.Workdir = r.renderWorkdir(pane.Workdir)
+	pane.Env = r.renderEnv(pane.Env)
+	return pane
+}
+
+// copy of environment variables with their values rendered
+func (r *templateRenderer) renderEnv(env map[string]string) map[string]string {
+	if env == nil {
+		return nil
+	}
+	rendered := map[string]string{}
+	for name, value := range env {
+		rendered[name] = r.render(value)
+	}
+	return rendered
+}
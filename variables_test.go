@@ -0,0 +1,110 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const variablesTestConfig = `
+profiles:
+  - name: web
+    vars:
+      host:
+      user: deploy
+      dir: $YAKCTL_TEST_DIR/app
+    tabs:
+      - name: "ssh {{ .host }}"
+        commands:
+          - "ssh {{ .user }}@{{ .host }}"
+          - 'cd {{ .dir }} && docker ps --format ''{{ "{{" }}.Names{{ "}}" }}'''
+  - name: plain
+    tabs:
+      - name: docker
+        commands:
+          - docker ps --format '{{.Names}}'
+`
+
+func TestLoadSessionsWithVariables(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	t.Setenv("YAKCTL_TEST_DIR", "/srv")
+	configuration := readTestConfig(t, variablesTestConfig)
+
+	if err := LoadSessions(configuration, []string{"web", "plain"}, map[string]string{"host": "10.0.0.5"}); err != nil {
+		t.Fatal(err)
+	}
+
+	web := sessionByTitle(t, fake, "ssh 10.0.0.5")
+	expected := []string{"ssh deploy@10.0.0.5", "cd /srv/app && docker ps --format '{{.Names}}'"}
+	if commands := fake.Commands(web.Terminals[0]); !reflect.DeepEqual(commands, expected) {
+		t.Errorf("unexpected commands %q", commands)
+	}
+	plain := sessionByTitle(t, fake, "docker")
+	if commands := fake.Commands(plain.Terminals[0]); !reflect.DeepEqual(commands, []string{"docker ps --format '{{.Names}}'"}) {
+		t.Errorf("profiles without vars must not be rendered: %q", commands)
+	}
+}
+
+func TestLoadSessionsMissingVariable(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	configuration := readTestConfig(t, variablesTestConfig)
+
+	err := LoadSessions(configuration, []string{"plain", "web"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "requires the variable(s) host") {
+		t.Errorf("expected a missing variable error, got %v", err)
+	}
+	err = LoadSessions(configuration, []string{"web"}, map[string]string{"host": "a", "port": "22"})
+	if err == nil || !strings.Contains(err.Error(), "variable 'port' is not declared") {
+		t.Errorf("expected an unknown variable error, got %v", err)
+	}
+	if len(fake.Sessions()) != 1 {
+		t.Errorf("no tab should be opened, got\n%s", fake)
+	}
+}
+
+func TestRenderProfileInvalidTemplate(t *testing.T) {
+	profile := &ProfileDescription{
+		Name: "broken",
+		Vars: map[string]*string{},
+		Tabs: []TabDescription{{Name: "tab", Terminal2: []Command{{Run: "echo {{ .missing }}"}}}},
+	}
+
+	_, err := RenderProfile(profile, nil)
+	if err == nil || !strings.Contains(err.Error(), "problem rendering tab 'tab' of profile 'broken'") {
+		t.Errorf("expected a rendering error, got %v", err)
+	}
+}
+
+func TestParseVariables(t *testing.T) {
+	variables, err := parseVariables([]string{"host=10.0.0.5", "query=a=b,c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(variables, map[string]string{"host": "10.0.0.5", "query": "a=b,c"}) {
+		t.Errorf("unexpected variables %v", variables)
+	}
+	if _, err := parseVariables([]string{"host"}); err == nil {
+		t.Error("expected an error for a missing value")
+	}
+}
@@ -24,51 +24,62 @@ import (
 	"github.com/gookit/color"
 	"github.com/urfave/cli/v2"
 	"os"
-	"path"
-	"strconv"
 	"strings"
+	"time"
 )
 
 func main() {
-	var configFile = ".yakctl.yml"
 	var configFilePath string
 	var configuration *YakCtlConfiguration
 	var verbose bool
 	var forceDeletion bool
-
-	hd, homeDirErr := os.UserHomeDir()
-	if homeDirErr != nil {
-		color.Errorf("%v", homeDirErr)
-		return
-	}
-	configFilePath = path.Join(hd, configFile)
+	var backend string
+	var appendSnapshot bool
+	var dryRun bool
 
 	app := &cli.App{
-		EnableBashCompletion: true,
-		Name:                 "yakctl",
-		Usage:                "Control the yakuake terminal and your terminal sessions",
-		Version:              "1.1.2",
-		HideHelp:             false,
-		HideVersion:          false,
+		EnableBashCompletion:      true,
+		DisableSliceFlagSeparator: true,
+		Name:                      "yakctl",
+		Usage:                     "Control the yakuake terminal and your terminal sessions",
+		Version:                   "1.1.2",
+		HideHelp:                  false,
+		HideVersion:               false,
 		Copyright: "yakctl\t2020\thttps://github.com/emschu/yakctl\n\n" +
 			"   This program comes with ABSOLUTELY NO WARRANTY.\n" +
 			"   This is free software, and you are welcome\n" +
 			"   to redistribute it under the conditions of the\n" +
 			"   GPLv3 (https://www.gnu.org/licenses/gpl-3.0.txt).",
 		Before: func(context *cli.Context) error {
-			// general startup logic
+			// general startup logic, the config commands work without yakuake
+			if context.Args().First() == "config" {
+				return nil
+			}
+			configuration = initApplication(&configFilePath, backend)
 			if verbose {
-				fmt.Printf("Using configuration file at: '%s'\n", configFilePath)
+				for _, source := range configuration.Sources {
+					fmt.Printf("Using configuration file at: '%s'\n", source.File)
+				}
+			}
+			if dryRun {
+				yakuake = newDryRunYakuake(yakuake)
 			}
-			configuration = initApplication(&configFilePath)
 
 			return nil
 		},
+		After: func(context *cli.Context) error {
+			if yakuake == nil {
+				return nil
+			}
+			if recorder, ok := yakuake.(*dryRunYakuake); ok {
+				recorder.PrintSummary()
+			}
+			return yakuake.Close()
+		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:        "config",
-				Usage:       "configuration file",
-				Value:       path.Join(hd, ".yakctl.yml"),
+				Usage:       "configuration file, default: $" + configEnvVar + " or the files shown by 'config path'",
 				Destination: &configFilePath,
 			},
 			&cli.BoolFlag{
@@ -77,6 +88,26 @@ func main() {
 				Value:       false,
 				Destination: &verbose,
 			},
+			&cli.StringFlag{
+				Name:        "backend",
+				Usage:       "how to talk to yakuake: 'dbus' (native D-Bus client) or 'qdbus' (qdbus command line tool)",
+				Value:       BackendDbus,
+				EnvVars:     []string{"YAKCTL_BACKEND"},
+				Destination: &backend,
+			},
+			&cli.DurationFlag{
+				Name:        "shell-timeout",
+				Usage:       "how long to wait for the shell of a new terminal and for the processes commands wait for, 0 disables waiting",
+				Value:       shellTimeout,
+				EnvVars:     []string{"YAKCTL_SHELL_TIMEOUT"},
+				Destination: &shellTimeout,
+			},
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "only print the changes to yakuake (and the configuration file) instead of performing them",
+				Value:       false,
+				Destination: &dryRun,
+			},
 		},
 		Commands: []*cli.Command{
 			{
@@ -96,6 +127,48 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:      "close",
+				Usage:     "Close tabs by session id or tab title, terminals by id or the tabs of a profile",
+				ArgsUsage: "[session id or tab title pattern...]",
+				Description: "Tab titles are matched as glob, * stands for any text and ? for a single character,\n" +
+					"or as regular expression between slashes like /^build-\\d+$/.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "terminal",
+						Aliases: []string{"t"},
+						Usage:   "list Ids of terminals separated by comma and without space",
+					},
+					&cli.StringSliceFlag{
+						Name:  "profile",
+						Usage: "close the tabs of a profile, matched by title, can be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "set",
+						Usage: "set a variable of the profile, format: name=value, can be repeated",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "close protected tabs, too",
+					},
+				},
+				Action: func(context *cli.Context) error {
+					terminalIDs, err := parseIDList(strings.TrimSpace(context.String("terminal")))
+					if err != nil {
+						return fmt.Errorf("invalid argument 'terminal': %v", err)
+					}
+					variables, err := parseVariables(context.StringSlice("set"))
+					if err != nil {
+						return err
+					}
+					return CloseSessions(configuration, CloseSelection{
+						Targets:   context.Args().Slice(),
+						Terminals: terminalIDs,
+						Profiles:  context.StringSlice("profile"),
+						Variables: variables,
+					}, context.Bool("force"))
+				},
+			},
 			{
 				Name:    "profile",
 				Aliases: []string{"p"},
@@ -108,14 +181,22 @@ func main() {
 					{
 						Name:      "show",
 						Aliases:   []string{"s"},
-						Usage:     "Shows all details of a defined profile",
-						ArgsUsage: "profile_id",
+						Usage:     "Shows all details of a profile, addressed by name or number",
+						ArgsUsage: "profile",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "output",
+								Aliases: []string{"o"},
+								Usage:   "output format: 'yaml', 'json' or 'toml'",
+								Value:   FormatYAML,
+							},
+						},
 						Action: func(context *cli.Context) error {
-							profileID, done, _ := getProfileID(context)
-							if done {
-								return fmt.Errorf("empty profile_id")
+							profileName, err := getProfileName(context)
+							if err != nil {
+								return err
 							}
-							profilePrintErr := PrintProfile(configuration, profileID)
+							profilePrintErr := PrintProfile(configuration, profileName, context.String("output"))
 							if profilePrintErr != nil {
 								color.Errorf("%v\n", profilePrintErr)
 							}
@@ -125,23 +206,189 @@ func main() {
 					{
 						Name:      "open",
 						Aliases:   []string{"o"},
-						Usage:     "Opens a defined profile",
-						ArgsUsage: "profile_id",
+						Usage:     "Opens one or more profiles, addressed by name or number",
+						ArgsUsage: "profile [profile...]",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  "set",
+								Usage: "set a variable of the profile, format: name=value, can be repeated",
+							},
+						},
 						Action: func(context *cli.Context) error {
-							profileID, done, err := getProfileID(context)
-							if done {
+							profileNames := context.Args().Slice()
+							if len(profileNames) == 0 {
+								return fmt.Errorf("missing argument 'profile'")
+							}
+							variables, err := parseVariables(context.StringSlice("set"))
+							if err != nil {
 								return err
 							}
 							if verbose {
-								profilePrintErr := PrintProfile(configuration, profileID)
-								if profilePrintErr != nil {
-									fmt.Printf("%v\n", profilePrintErr)
+								for _, profileName := range profileNames {
+									profilePrintErr := PrintProfile(configuration, profileName, FormatYAML)
+									if profilePrintErr != nil {
+										fmt.Printf("%v\n", profilePrintErr)
+									}
 								}
 							}
-							err2 := LoadSession(configuration, profileID)
-							if err2 != nil {
+							return LoadSessions(configuration, profileNames, variables)
+						},
+					},
+					{
+						Name:      "apply",
+						Aliases:   []string{"a"},
+						Usage:     "Opens missing tabs of a profile and updates the flags of existing ones, tabs are matched by title",
+						ArgsUsage: "profile",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "prune",
+								Usage: "close tabs not described by the profile, except the protected ones",
+								Value: false,
+							},
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "close protected tabs not described by the profile, too",
+								Value: false,
+							},
+							&cli.StringSliceFlag{
+								Name:  "set",
+								Usage: "set a variable of the profile, format: name=value, can be repeated",
+							},
+						},
+						Action: func(context *cli.Context) error {
+							profileName, err := getProfileName(context)
+							if err != nil {
+								return err
+							}
+							variables, err := parseVariables(context.StringSlice("set"))
+							if err != nil {
+								return err
+							}
+							return ApplyProfile(configuration, profileName, variables, context.Bool("prune"), context.Bool("force"))
+						},
+					},
+					{
+						Name:      "diff",
+						Aliases:   []string{"d"},
+						Usage:     "Shows what opening (or applying) a profile would change, without changing anything",
+						ArgsUsage: "profile",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "apply",
+								Usage: "compare with 'profile apply' instead of 'profile open'",
+								Value: false,
+							},
+							&cli.BoolFlag{
+								Name:  "prune",
+								Usage: "with --apply: like 'profile apply --prune'",
+								Value: false,
+							},
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "with --apply: like 'profile apply --force'",
+								Value: false,
+							},
+							&cli.StringFlag{
+								Name:    "output",
+								Aliases: []string{"o"},
+								Usage:   "output format: 'text' or 'json'",
+								Value:   "text",
+							},
+							&cli.StringSliceFlag{
+								Name:  "set",
+								Usage: "set a variable of the profile, format: name=value, can be repeated",
+							},
+						},
+						Action: func(context *cli.Context) error {
+							profileName, err := getProfileName(context)
+							if err != nil {
+								return err
+							}
+							variables, err := parseVariables(context.StringSlice("set"))
+							if err != nil {
+								return err
+							}
+							return DiffProfile(configuration, profileName, variables, context.Bool("apply"), context.Bool("prune"),
+								context.Bool("force"), context.String("output"))
+						},
+					},
+				},
+			},
+			{
+				Name:  "config",
+				Usage: "Inspect the configuration",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "path",
+						Usage: "Shows which configuration files are used and how they are merged",
+						Action: func(context *cli.Context) error {
+							c, err := readDiscoveredConfig(configFilePath)
+							if err != nil {
 								return err
 							}
+							PrintConfigSources(c)
+							return nil
+						},
+					},
+					{
+						Name:  "validate",
+						Usage: "Checks the configuration and reports all problems with their position",
+						Action: func(context *cli.Context) error {
+							workingDir, err := os.Getwd()
+							if err != nil {
+								return err
+							}
+							files, err := DiscoverConfigFiles(configFilePath, workingDir)
+							if err != nil {
+								return err
+							}
+							if !ValidateConfiguration(files) {
+								return cli.Exit("", 1)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "convert",
+						Usage:     "Prints a configuration file in another format, default: the most specific configuration file",
+						ArgsUsage: "[file]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "to",
+								Usage:    "target format: 'yaml', 'json' or 'toml'",
+								Required: true,
+							},
+						},
+						Action: func(context *cli.Context) error {
+							file := context.Args().First()
+							if len(file) == 0 {
+								workingDir, err := os.Getwd()
+								if err != nil {
+									return err
+								}
+								files, err := DiscoverConfigFiles(configFilePath, workingDir)
+								if err != nil {
+									return err
+								}
+								file = files[0].File
+							}
+							converted, err := ConvertConfigFile(file, context.String("to"))
+							if err != nil {
+								return err
+							}
+							fmt.Print(string(converted))
+							return nil
+						},
+					},
+					{
+						Name:  "schema",
+						Usage: "Prints a JSON schema of the configuration file for editors",
+						Action: func(context *cli.Context) error {
+							schema, err := ConfigSchema()
+							if err != nil {
+								return err
+							}
+							fmt.Println(string(schema))
 							return nil
 						},
 					},
@@ -152,12 +399,44 @@ func main() {
 				Aliases:   []string{"e"},
 				Usage:     "Execute a command in all or specific terminals",
 				ArgsUsage: "command to be executed in all or specified terminals",
+				Description: "Tab titles are matched as glob, * stands for any text and ? for a single character,\n" +
+					"or as regular expression between slashes like /^build-\\d+$/.\n" +
+					"Selectors of --exclude are terminal:ids, session:ids, tab:pattern, profile:name or active,\n" +
+					"the kind is required and the value is everything after its colon, e.g. 'tab:ssh host:22'.",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:    "terminal",
 						Aliases: []string{"t"},
 						Usage:   "list Ids of terminals separated by comma and without space",
 					},
+					&cli.StringFlag{
+						Name:  "session",
+						Usage: "list Ids of sessions separated by comma and without space, all their terminals are selected",
+					},
+					&cli.StringSliceFlag{
+						Name:  "tab",
+						Usage: "select the terminals of the tabs whose title matches a pattern, can be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "profile",
+						Usage: "select the terminals of the tabs of a profile, matched by title, can be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "set",
+						Usage: "set a variable of the profile, format: name=value, can be repeated",
+					},
+					&cli.BoolFlag{
+						Name:  "active",
+						Usage: "select the active terminal",
+					},
+					&cli.StringFlag{
+						Name:  "pane",
+						Usage: "select only a pane of the selected tabs, or of all tabs, by number starting at 1 or by its name in the profile",
+					},
+					&cli.StringSliceFlag{
+						Name:  "exclude",
+						Usage: "exclude the terminals of a selector: terminal:ids, session:ids, tab:pattern, profile:name or active, can be repeated",
+					},
 				},
 				Action: func(context *cli.Context) error {
 					command := strings.Join(context.Args().Slice(), " ")
@@ -165,16 +444,77 @@ func main() {
 						color.Error.Printf("Invalid empty command input detected\n")
 						return nil
 					}
-					color.Info.Printf("Execute '%s' in all terminals\n", command)
-					terminalIDInput := strings.Trim(context.String("terminal"), " ")
-					var terminalIDs []string
-					if len(terminalIDInput) > 0 {
-						terminalIDs = strings.Split(terminalIDInput, ",")
+					terminalIDs, parseErr := parseIDList(strings.TrimSpace(context.String("terminal")))
+					if parseErr != nil {
+						return fmt.Errorf("invalid argument 'terminal': %v", parseErr)
+					}
+					sessionIDs, parseErr := parseIDList(strings.TrimSpace(context.String("session")))
+					if parseErr != nil {
+						return fmt.Errorf("invalid argument 'session': %v", parseErr)
+					}
+					variables, err := parseVariables(context.StringSlice("set"))
+					if err != nil {
+						return err
+					}
+					selection := TerminalSelection{
+						Terminals: terminalIDs,
+						Sessions:  sessionIDs,
+						Tabs:      context.StringSlice("tab"),
+						Profiles:  context.StringSlice("profile"),
+						Variables: variables,
+						Active:    context.Bool("active"),
+						Pane:      strings.TrimSpace(context.String("pane")),
+						Exclude:   context.StringSlice("exclude"),
+					}
+					var affectedTerminals []int
+					if selection.IsEmpty() {
+						color.Info.Printf("Execute '%s' in all terminals\n", command)
+					} else {
+						if affectedTerminals, err = SelectTerminals(configuration, selection); err != nil {
+							return err
+						}
+						color.Info.Printf("Execute '%s' in the terminal(s) %s\n", command, joinIDs(affectedTerminals))
+					}
+					ExecuteCommand(command, &affectedTerminals)
+					return nil
+				},
+			},
+			{
+				Name:      "snapshot",
+				Usage:     "Describe the currently opened tabs as profile",
+				ArgsUsage: "profile_name",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:        "append",
+						Usage:       "append the profile to the configuration file instead of printing it",
+						Value:       false,
+						Destination: &appendSnapshot,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					name := strings.TrimSpace(context.Args().First())
+					if len(name) == 0 {
+						return fmt.Errorf("missing argument 'profile_name'")
+					}
+					profile, err := TakeSnapshot(name)
+					if err != nil {
+						return err
+					}
+					if appendSnapshot && dryRun {
+						color.Info.Printf("Dry run: profile '%s' would be appended to '%s'\n", name, configFilePath)
+					} else if appendSnapshot {
+						appendErr := AppendProfile(configFilePath, configuration, profile)
+						if appendErr != nil {
+							return appendErr
+						}
+						color.Success.Printf("Profile '%s' with %d tab(s) added to '%s'\n", name, len(profile.Tabs), configFilePath)
+						return nil
 					}
-					if len(terminalIDs) > 0 {
-						color.Info.Printf("Affected terminal ids: %v\n", strings.Join(terminalIDs, ","))
+					entry, err := MarshalProfileEntry(profile)
+					if err != nil {
+						return err
 					}
-					ExecuteCommand(command, &terminalIDs)
+					fmt.Print(string(entry))
 					return nil
 				},
 			},
@@ -182,9 +522,29 @@ func main() {
 				Name:    "status",
 				Aliases: []string{"s"},
 				Usage:   "List status (=sessions, terminals) of the current yakuake instance",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "output format: 'text' (tree), 'table', 'json', 'yaml' or 'tsv'",
+						Value:   "text",
+					},
+					&cli.BoolFlag{
+						Name:    "watch",
+						Aliases: []string{"w"},
+						Usage:   "refresh the status until interrupted",
+					},
+					&cli.DurationFlag{
+						Name:  "interval",
+						Usage: "time between two refreshes with --watch",
+						Value: 2 * time.Second,
+					},
+				},
 				Action: func(context *cli.Context) error {
-					ShowStatus()
-					return nil
+					if context.Bool("watch") {
+						return WatchStatus(context.String("output"), context.Duration("interval"))
+					}
+					return ShowStatus(context.String("output"))
 				},
 			},
 		},
@@ -195,30 +555,40 @@ func main() {
 	}
 }
 
-// get profile_id out of cli arguments
-func getProfileID(context *cli.Context) (int64, bool, error) {
-	if 0 == context.Args().Len() {
-		return 0, true, fmt.Errorf("missing argument 'profile_id'")
+// get the profile name or number out of cli arguments
+func getProfileName(context *cli.Context) (string, error) {
+	profileName := strings.TrimSpace(context.Args().First())
+	if len(profileName) == 0 {
+		return "", fmt.Errorf("missing argument 'profile'")
+	}
+	return profileName, nil
+}
+
+// read the configuration files found by DiscoverConfigFiles
+func readDiscoveredConfig(configFile string) (*YakCtlConfiguration, error) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
 	}
-	profileID, err := strconv.ParseInt(context.Args().First(), 10, 32)
+	files, err := DiscoverConfigFiles(configFile, workingDir)
 	if err != nil {
-		color.Errorf("Invalid argument 'profile_id'\n")
-		return 0, true, err
+		return nil, err
 	}
-	return profileID, false, nil
+	return ReadConfigFiles(files)
 }
 
-// method to handle startup of the application
-func initApplication(configFile *string) *YakCtlConfiguration {
-	isValid := CheckRequirements()
+// method to handle startup of the application, configFile is set to the most specific configuration file
+func initApplication(configFile *string, backend string) *YakCtlConfiguration {
+	isValid := CheckRequirements(backend)
 	if !isValid {
 		color.Errorf("Problems detected. yakctl is unable to start.\n")
 		os.Exit(1)
 	}
-	c, confErr := ReadConfig(*configFile)
+	c, confErr := readDiscoveredConfig(*configFile)
 	if confErr != nil {
-		color.Errorf("Invalid configuration detected in configuration file '%s'\n%v\n", *configFile, confErr)
+		color.Errorf("Invalid configuration detected\n%v\n", confErr)
 		os.Exit(1)
 	}
+	*configFile = c.Sources[0].File
 	return c
 }
@@ -22,15 +22,12 @@ package main
 import (
 	"fmt"
 	"github.com/gookit/color"
-	"os/exec"
-	"strconv"
 	"strings"
 	"time"
 )
 
 // remember: a dbus cmd consists of service + path + interface method
 const (
-	DbusApp     = "qdbus"
 	DbusService = "org.kde.yakuake"
 	// paths
 	DbusPathSessions   = "/yakuake/sessions"
@@ -45,6 +42,9 @@ const (
 	DbusMethodSetSessionMonitorSilence   = "org.kde.yakuake.setSessionMonitorSilenceEnabled"
 	DbusMethodSetSessionMonitorActivity  = "org.kde.yakuake.setSessionMonitorActivityEnabled"
 	DbusMethodSetKeyboardInputEnabled    = "org.kde.yakuake.setSessionKeyboardInputEnabled"
+	DbusMethodIsSessionMonitorSilence    = "org.kde.yakuake.isSessionMonitorSilenceEnabled"
+	DbusMethodIsSessionMonitorActivity   = "org.kde.yakuake.isSessionMonitorActivityEnabled"
+	DbusMethodIsKeyboardInputEnabled     = "org.kde.yakuake.isSessionKeyboardInputEnabled"
 	DbusMethodTerminalIDList             = "org.kde.yakuake.terminalIdList"
 	DbusMethodTerminalIDListForSessionID = "org.kde.yakuake.terminalIdsForSessionId"
 	DbusMethodTerminalRemoval            = "org.kde.yakuake.removeTerminal"
@@ -54,10 +54,16 @@ const (
 	DbusMethodSetSessionClosable         = "org.kde.yakuake.setSessionClosable"
 	DbusMethodRunCommandInTerminal       = "org.kde.yakuake.runCommandInTerminal"
 	DbusMethodActiveSessionId            = "org.kde.yakuake.activeSessionId"
+	DbusMethodActiveTerminalId           = "org.kde.yakuake.activeTerminalId"
+	DbusMethodSetTerminalKeyboardInput   = "org.kde.yakuake.setTerminalKeyboardInputEnabled"
+	DbusMethodIsTerminalKeyboardInput    = "org.kde.yakuake.isTerminalKeyboardInputEnabled"
+	DbusMethodSplitTerminalLeftRight     = "org.kde.yakuake.splitTerminalLeftRight"
+	DbusMethodSplitTerminalTopBottom     = "org.kde.yakuake.splitTerminalTopBottom"
 
 	// methods for paths = tabs
-	DbusMethodTabTitle    = "org.kde.yakuake.tabTitle"
-	DbusMethodSetTabTitle = "org.kde.yakuake.setTabTitle"
+	DbusMethodTabTitle     = "org.kde.yakuake.tabTitle"
+	DbusMethodSetTabTitle  = "org.kde.yakuake.setTabTitle"
+	DbusMethodSessionAtTab = "org.kde.yakuake.sessionAtTab"
 
 	// methods for path = window
 	DbusMethodToggleState = "org.kde.yakuake.toggleWindowState"
@@ -65,17 +71,43 @@ const (
 	// methods for path = MainWindow_1
 	DbusMethodQwidgetVisible = "org.qtproject.Qt.QWidget.visible"
 
+	// konsole sessions of yakuake are exported as /Sessions/<terminal id + 1>
+	DbusPathKonsoleSessions              = "/Sessions"
+	DbusMethodKonsoleProcessID           = "org.kde.konsole.Session.processId"
+	DbusMethodKonsoleForegroundProcessID = "org.kde.konsole.Session.foregroundProcessId"
+	DbusMethodKonsoleDisplayedText       = "org.kde.konsole.Session.getAllDisplayedText"
+	DbusMethodKonsoleSendText            = "org.kde.konsole.Session.sendText"
+	DbusMethodIntrospect                 = "org.freedesktop.DBus.Introspectable.Introspect"
+
 	DbusMethodPing = "org.freedesktop.DBus.Peer.Ping"
 )
 
 // LoadSession method to load a yakuake session defined in yaml configuration
-func LoadSession(configuration *YakCtlConfiguration, profileID int64) error {
-	profile, err := GetProfile(configuration, profileID)
-	if err != nil {
+func LoadSession(configuration *YakCtlConfiguration, profileName string) error {
+	return LoadSessions(configuration, []string{profileName}, nil)
+}
+
+// LoadSessions loads several profiles in the given order. Tabs with a name already opened by a previous profile are skipped.
+// If any profile clears, the existing sessions are cleared once before the first profile, forced if any clearing profile
+// forces. Only the terminals of the active session, which yakctl possibly runs in, are cleared at the end.
+// The window is toggled once. All profiles are rendered with the given variables before any tab is opened.
+func LoadSessions(configuration *YakCtlConfiguration, profileNames []string, variables map[string]string) error {
+	var profiles []*ProfileDescription
+	for _, profileName := range profileNames {
+		profile, err := getRenderedProfile(configuration, profileName, variables)
+		if err != nil {
+			return err
+		}
+		if err := checkWorkdirs(profile); err != nil {
+			return err
+		}
+		profiles = append(profiles, profile)
+	}
+	if err := checkVariablesDeclared(profiles, variables); err != nil {
 		return err
 	}
 
-	currentlyOpenedSessionID := getCurrentSessionId()
+	currentlyOpenedSessionID := getCurrentSessionID()
 
 	// store these ids for later to avoid killing the shell we possibly run in
 	openedTerminalsBeforeLoad, termErrs := getAllTerminalIDs()
@@ -83,75 +115,128 @@ func LoadSession(configuration *YakCtlConfiguration, profileID int64) error {
 		return termErrs
 	}
 
-	for _, tab := range profile.Tabs {
-		sessionID := startSession(&tab)
-		if sessionID == nil || len(*sessionID) == 0 {
-			return fmt.Errorf("problem creating session for new tab")
+	clearAll := false
+	forceClear := false
+	for _, profile := range profiles {
+		if profile.ClearAll {
+			clearAll = true
+			forceClear = forceClear || profile.ForceClear
 		}
+	}
+	otherTerminals, activeSessionTerminals := splitBySession(openedTerminalsBeforeLoad, currentlyOpenedSessionID)
+	cleared := false
+	if clearAll && len(otherTerminals) > 0 {
+		cleared = clearSessions(forceClear, otherTerminals, &currentlyOpenedSessionID)
+	}
 
-		// set title
-		executeCmdVoid(DbusPathTabs, DbusMethodSetTabTitle, *sessionID, tab.Name)
-
-		// get terminal ids of session
-		terminalIDs := getTerminalIDsForSessionID(sessionID)
-
-		// commands are executed on each terminal, before the specific stuff commands will be executed
-		for _, command := range tab.Commands {
-			for _, terminalID := range terminalIDs {
-				executeCommandInTerminal(command, terminalID)
+	openedTabs := map[string]string{}
+	for _, profile := range profiles {
+		for _, tab := range profile.Tabs {
+			if openedBy, exists := openedTabs[tab.Name]; exists {
+				color.Warn.Printf("Skipping tab '%s' of profile '%s', it is already opened by profile '%s'\n", tab.Name, profile.Name, openedBy)
+				continue
 			}
-		}
-		// handle different terminals
-		if len(terminalIDs) > 0 {
-			for _, t1Cmd := range tab.Terminal1 {
-				executeCommandInTerminal(t1Cmd, terminalIDs[0])
-			}
-		}
-		if len(terminalIDs) > 1 {
-			for _, t2Cmd := range tab.Terminal2 {
-				executeCommandInTerminal(t2Cmd, terminalIDs[1])
+			if _, err := openTab(&tab); err != nil {
+				return err
 			}
+			openedTabs[tab.Name] = profile.Name
 		}
-		if len(terminalIDs) > 2 {
-			for _, t3Cmd := range tab.Terminal3 {
-				executeCommandInTerminal(t3Cmd, terminalIDs[2])
-			}
-		}
-		if len(terminalIDs) > 3 {
-			for _, t4Cmd := range tab.Terminal4 {
-				executeCommandInTerminal(t4Cmd, terminalIDs[3])
-			}
-		}
-		// handle flags
-		if tab.Protected {
-			executeCmdVoid(DbusPathSessions, DbusMethodSetSessionClosable, *sessionID, "false")
-		}
-		if tab.MonitorSilence {
-			executeCmdVoid(DbusPathSessions, DbusMethodSetSessionMonitorSilence, *sessionID, "true")
-		}
-		if tab.MonitorActivity {
-			executeCmdVoid(DbusPathSessions, DbusMethodSetSessionMonitorActivity, *sessionID, "true")
-		}
-		if tab.DisableKeyboardInput {
-			executeCmdVoid(DbusPathSessions, DbusMethodSetKeyboardInputEnabled, *sessionID, "false")
-		}
-		color.Success.Printf("Created new session #%s\n", *sessionID)
 	}
 
 	// toggle window
 	if !isWindowShown() {
 		// toggle window
-		executeCmdVoid(DbusPathWindow, DbusMethodToggleState)
+		warnOnError(yakuake.ToggleWindowState())
 	}
 
-	// clean up
-	if profile.ClearAll {
-		clearSessions(profile.ForceClear, openedTerminalsBeforeLoad, &currentlyOpenedSessionID)
+	// clean up the active session last
+	if clearAll && len(activeSessionTerminals) > 0 {
+		cleared = clearSessions(forceClear, activeSessionTerminals, &currentlyOpenedSessionID) || cleared
+	}
+	if cleared {
+		color.Success.Println("All sessions cleared!")
 	}
 
 	return nil
 }
 
+// open a new tab, run its commands and set its flags
+func openTab(tab *TabDescription) (int, error) {
+	sessionID, sessionErr := startSession(tab)
+	if sessionErr != nil {
+		return -1, fmt.Errorf("problem creating session for new tab: %v", sessionErr)
+	}
+
+	// set title
+	warnOnError(yakuake.SetTabTitle(sessionID, tab.Name))
+
+	// split the single terminal of the session along the layout
+	var panes []terminalPane
+	layout := tab.effectiveLayout()
+	if layout != nil {
+		if initialTerminalIDs := getTerminalIDsForSessionID(sessionID); len(initialTerminalIDs) > 0 {
+			var layoutErr error
+			panes, layoutErr = buildLayout(layout, initialTerminalIDs[0])
+			if layoutErr != nil {
+				color.Error.Printf("Problem creating the layout of tab '%s': %v\n", tab.Name, layoutErr)
+			}
+		}
+	}
+
+	// get terminal ids of session
+	terminalIDs := getTerminalIDsForSessionID(sessionID)
+	if layout == nil {
+		panes = tabPanes(tab, terminalIDs)
+	}
+
+	// terminals change to their working directory and export their environment first, so all commands are executed in it.
+	// The commands of the tab are executed in each terminal, before the specific commands of its pane.
+	paneOfTerminal := map[int]*PaneDescription{}
+	for _, pane := range panes {
+		paneOfTerminal[pane.terminalID] = pane.pane
+	}
+	terminalCommands := map[int][]Command{}
+	var busyTerminalIDs []int
+	for _, terminalID := range terminalIDs {
+		var commands []Command
+		if setup := paneSetupCommand(tab, paneOfTerminal[terminalID]); len(setup) > 0 {
+			commands = append(commands, Command{Run: setup})
+		}
+		commands = append(commands, tab.Commands...)
+		if pane := paneOfTerminal[terminalID]; pane != nil {
+			commands = append(commands, pane.Commands...)
+		}
+		if len(commands) > 0 {
+			terminalCommands[terminalID] = commands
+			busyTerminalIDs = append(busyTerminalIDs, terminalID)
+		}
+	}
+	waitForShells(busyTerminalIDs)
+	for _, terminalID := range busyTerminalIDs {
+		runCommands(terminalCommands[terminalID], terminalID)
+	}
+	for _, pane := range panes {
+		if pane.pane.DisableKeyboardInput {
+			warnOnError(yakuake.SetTerminalKeyboardInputEnabled(pane.terminalID, false))
+		}
+	}
+	// handle flags
+	if tab.Protected {
+		warnOnError(yakuake.SetSessionClosable(sessionID, false))
+	}
+	if tab.MonitorSilence {
+		warnOnError(yakuake.SetSessionMonitorSilenceEnabled(sessionID, true))
+	}
+	if tab.MonitorActivity {
+		warnOnError(yakuake.SetSessionMonitorActivityEnabled(sessionID, true))
+	}
+	if tab.DisableKeyboardInput {
+		warnOnError(yakuake.SetSessionKeyboardInputEnabled(sessionID, false))
+	}
+	color.Success.Printf("Created new session #%d\n", sessionID)
+	return sessionID, nil
+}
+
 // ClearSession method to reset yakuake
 func ClearSession(forceDeletion bool) {
 	// get all terminal Ids and remove them afterwards
@@ -162,11 +247,13 @@ func ClearSession(forceDeletion bool) {
 		return
 	}
 
-	clearSessions(forceDeletion, terminalIDs, nil)
+	if clearSessions(forceDeletion, terminalIDs, nil) {
+		color.Success.Println("All sessions cleared!")
+	}
 }
 
 // ExecuteCommand method to execute a command in all or in specified terminals
-func ExecuteCommand(command string, affectedTerminals *[]string) {
+func ExecuteCommand(command string, affectedTerminals *[]int) {
 	if len(*affectedTerminals) == 0 {
 		var err error
 		*affectedTerminals, err = getAllTerminalIDs()
@@ -180,30 +267,13 @@ func ExecuteCommand(command string, affectedTerminals *[]string) {
 	}
 }
 
-// ShowStatus show sessions and terminals of the current yakuake instance
-func ShowStatus() {
-	sessionIDs, err := getAllSessionIDs()
-	if err != nil {
-		color.Errorf("%v\n", sessionIDs)
-		return
-	}
-	for _, sessionID := range sessionIDs {
-		tabTitle := getTitleOfSession(sessionID)
-		color.Info.Printf("- session #%s, tab title: %s\n", sessionID, *tabTitle)
-		terminalIds := getTerminalIDsForSessionID(&sessionID)
-		for _, terminalID := range terminalIds {
-			color.Info.Printf("\t|- Terminal #%s\n", terminalID)
-		}
-	}
-}
-
-// clear the specified terminals
-func clearSessions(forceDeletion bool, terminalIDs []string, lastSessionId *string) {
-	var currentlyActiveSessionID string
-	if lastSessionId == nil {
-		currentlyActiveSessionID = getCurrentSessionId()
+// clear the specified terminals, the terminals of the active session last, true if any terminal was closed
+func clearSessions(forceDeletion bool, terminalIDs []int, lastSessionID *int) bool {
+	var currentlyActiveSessionID int
+	if lastSessionID == nil {
+		currentlyActiveSessionID = getCurrentSessionID()
 	} else {
-		currentlyActiveSessionID = *lastSessionId
+		currentlyActiveSessionID = *lastSessionID
 	}
 
 	if len(terminalIDs) == 0 {
@@ -220,193 +290,280 @@ func clearSessions(forceDeletion bool, terminalIDs []string, lastSessionId *stri
 
 	// strip currently active shell from the terminal id slice
 	// split the slice into now and postponed
-	var isCurrentTerminalPostponed = false
-	var cleanedUpTerminalIDList = terminalIDs
-	var postponedTerminalIDs []string
-
-	for i, tID := range terminalIDs {
-		sessionIDOfTerminal := getSessionIDForTerminalID(tID)
-		if sessionIDOfTerminal == currentlyActiveSessionID {
-			cleanedUpTerminalIDList = append(terminalIDs[:i], terminalIDs[i+1:]...)
-			isCurrentTerminalPostponed = true
-			postponedTerminalIDs = append(postponedTerminalIDs, tID)
+	cleanedUpTerminalIDList, postponedTerminalIDs := splitBySession(terminalIDs, currentlyActiveSessionID)
+	// forcing makes sessions closable, sessions which are only partly closed are protected again afterwards.
+	// Their terminals are remembered before the removal.
+	var protectedSessionIDs []int
+	protectedSessionTerminals := map[int][]int{}
+	if forceDeletion {
+		for _, tID := range terminalIDs {
+			sessionIDOfTerminal := getSessionIDForTerminalID(tID)
+			if sessionIDOfTerminal < 0 || containsID(protectedSessionIDs, sessionIDOfTerminal) {
+				continue
+			}
+			if closable, err := yakuake.IsSessionClosable(sessionIDOfTerminal); err == nil && !closable {
+				protectedSessionIDs = append(protectedSessionIDs, sessionIDOfTerminal)
+				protectedSessionTerminals[sessionIDOfTerminal] = getTerminalIDsForSessionID(sessionIDOfTerminal)
+			}
 		}
 	}
 
-	processTerminalRemoval(&forceDeletion, &cleanedUpTerminalIDList, &didSomething)
+	var removedTerminalIDs []int
+	processTerminalRemoval(&forceDeletion, &cleanedUpTerminalIDList, &didSomething, &removedTerminalIDs)
 
 	// remove the currently opened terminal at the end
-	if isCurrentTerminalPostponed {
-		processTerminalRemoval(&forceDeletion, &postponedTerminalIDs, &didSomething)
+	if len(postponedTerminalIDs) > 0 {
+		processTerminalRemoval(&forceDeletion, &postponedTerminalIDs, &didSomething, &removedTerminalIDs)
+	}
+	for _, sessionID := range protectedSessionIDs {
+		restoreProtection(sessionID, protectedSessionTerminals[sessionID], removedTerminalIDs)
 	}
 
-	if didSomething {
-		color.Success.Println("All sessions cleared!")
+	return didSomething
+}
+
+// split terminals into the ones of other sessions and the ones of the given session, which may be -1 for none
+func splitBySession(terminalIDs []int, sessionID int) ([]int, []int) {
+	var others, ofSession []int
+	for _, tID := range terminalIDs {
+		if sessionID >= 0 && getSessionIDForTerminalID(tID) == sessionID {
+			ofSession = append(ofSession, tID)
+		} else {
+			others = append(others, tID)
+		}
 	}
+	return others, ofSession
 }
 
-func getCurrentSessionId() string {
-	currentlyActiveSessionID, activeSessionIDErr := executeCmd(DbusPathSessions, DbusMethodActiveSessionId)
-	if activeSessionIDErr != nil {
-		color.Errorf("problem fetching current active session id")
+// protect a session again, if any of its terminals was not removed. The removed terminals are the ones of the
+// removal itself, so this also holds for a dry run, which does not remove them from yakuake.
+func restoreProtection(sessionID int, sessionTerminalIDs []int, removedTerminalIDs []int) {
+	for _, tID := range sessionTerminalIDs {
+		if !containsID(removedTerminalIDs, tID) {
+			warnOnError(yakuake.SetSessionClosable(sessionID, false))
+			return
+		}
+	}
+}
+
+func containsID(ids []int, id int) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
 	}
-	if currentlyActiveSessionID == "-1" {
-		currentlyActiveSessionID = ""
+	return false
+}
+
+// get the id of the active session, -1 if there is none
+func getCurrentSessionID() int {
+	currentlyActiveSessionID, activeSessionIDErr := yakuake.ActiveSessionID()
+	if activeSessionIDErr != nil {
+		color.Errorf("problem fetching current active session id\n")
+		return -1
 	}
 	return currentlyActiveSessionID
 }
 
-func processTerminalRemoval(forceDeletion *bool, terminalIDs *[]string, didSomething *bool) {
+// remove terminals, the ones removed are appended to removedTerminalIDs
+func processTerminalRemoval(forceDeletion *bool, terminalIDs *[]int, didSomething *bool, removedTerminalIDs *[]int) {
 	for _, tID := range *terminalIDs {
 		closable, title := isTerminalClosable(tID)
 		if !closable && !*forceDeletion {
-			color.Warn.Printf("Terminal #%s ('%s') is protected and not closable. Do it manually!\n", tID, *title)
+			color.Warn.Printf("Terminal #%d ('%s') is protected and not closable. Do it manually!\n", tID, title)
 		}
 		sessionID := getSessionIDForTerminalID(tID)
-		if *forceDeletion {
+		if *forceDeletion && sessionID >= 0 {
 			// set closable by dbus command
-			for _, id := range strings.Split(sessionID, ",") {
-				executeCmdVoid(DbusPathSessions, DbusMethodSetSessionClosable, id, "true")
-				time.Sleep(10 * time.Millisecond)
-			}
+			warnOnError(yakuake.SetSessionClosable(sessionID, true))
+			time.Sleep(10 * time.Millisecond)
 		}
 		if !closable && !*forceDeletion {
 			continue
 		}
 		tabTitle := getTitleOfSession(sessionID)
 
-		_, terminalRemovalErr := executeCmd(DbusPathSessions, DbusMethodTerminalRemoval, tID)
+		terminalRemovalErr := yakuake.RemoveTerminal(tID)
 		if terminalRemovalErr != nil {
-			color.Warn.Printf("Terminal with terminalId #%s can't be removed! %v\n", tID, terminalRemovalErr)
+			color.Warn.Printf("Terminal with terminalId #%d can't be removed! %v\n", tID, terminalRemovalErr)
 		} else {
 			*didSomething = true
-			color.Info.Printf("Closing terminal #%s with session #%s and title '%s'\n", tID, sessionID, *tabTitle)
+			*removedTerminalIDs = append(*removedTerminalIDs, tID)
+			color.Info.Printf("Closing terminal #%d with session #%d and title '%s'\n", tID, sessionID, tabTitle)
 		}
 	}
 }
 
 // method to get terminal_ids of all open sessions
-func getAllTerminalIDs() ([]string, error) {
-	terminalIDOutput, err := executeCmd(DbusPathSessions, DbusMethodTerminalIDList)
+func getAllTerminalIDs() ([]int, error) {
+	terminalIDs, err := yakuake.TerminalIDs()
 	if err != nil {
 		color.Error.Printf("Problem fetching terminalIDs of yakuake\n")
 		return nil, err
 	}
-	var terminalIDs = strings.Split(terminalIDOutput, ",")
 	return terminalIDs, nil
 }
 
 // get all session ids currently open
-func getAllSessionIDs() ([]string, error) {
-	sessionIDOutput, err := executeCmd(DbusPathSessions, DbusMethodSessionIDList)
+func getAllSessionIDs() ([]int, error) {
+	sessionIDs, err := yakuake.SessionIDs()
 	if err != nil {
 		color.Error.Printf("Problem fetching sessionIDs of yakuake\n")
 		return nil, err
 	}
-	var sessionIDs = strings.Split(sessionIDOutput, ",")
 	return sessionIDs, nil
 }
 
 // get terminal ids of a single sessions id
-func getTerminalIDsForSessionID(sessionID *string) []string {
-	terminalIDOutput, _ := executeCmd(DbusPathSessions, DbusMethodTerminalIDListForSessionID, *sessionID)
-	terminalIDs := strings.Split(terminalIDOutput, ",")
+func getTerminalIDsForSessionID(sessionID int) []int {
+	terminalIDs, err := yakuake.TerminalIDsForSessionID(sessionID)
+	if err != nil {
+		color.Error.Printf("Problem fetching terminalIDs of session #%d. %v\n", sessionID, err)
+		return nil
+	}
 	return terminalIDs
 }
 
 // checks if yakuake window is shown
 func isWindowShown() bool {
-	isShownOutput, visibleErr := executeCmd(DbusPathMainwindow, DbusMethodQwidgetVisible)
+	isShown, visibleErr := yakuake.IsWindowVisible()
 	if visibleErr != nil {
 		color.Error.Printf("Problem fetching open state of yakuake window. %v.\n", visibleErr)
 		return true
 	}
-	parseBool, err := strconv.ParseBool(isShownOutput)
+	return isShown
+}
+
+// wrapper method to execute a command in a specific terminal
+func executeCommandInTerminal(command string, terminalID int) {
+	color.Info.Printf("Execute command '%s' in terminal #%d\n", command, terminalID)
+	warnOnError(yakuake.RunCommandInTerminal(terminalID, command))
+}
+
+// wrapper method to type text into a specific terminal without executing it
+func sendKeysToTerminal(text string, terminalID int) {
+	color.Info.Printf("Send keys %q to terminal #%d\n", text, terminalID)
+	warnOnError(yakuake.SendTextToTerminal(terminalID, text))
+}
+
+// the number of terminals of a tab by the names of its split mode, case-insensitive
+var splitModeTerminals = map[string]int{
+	"":           1,
+	"left-right": 2,
+	"horizontal": 2,
+	"lr":         2,
+	"top-bottom": 2,
+	"vertical":   2,
+	"tb":         2,
+	"quad":       4,
+	"qu":         4,
+}
+
+// the panes of a tab assigned to the terminals of its session in order, panes without terminal are skipped
+func tabPanes(tab *TabDescription, terminalIDs []int) []terminalPane {
+	var panes []terminalPane
+	for i, pane := range tab.terminalPanes() {
+		if i >= len(terminalIDs) {
+			break
+		}
+		panes = append(panes, terminalPane{pane: &pane, terminalID: terminalIDs[i]})
+	}
+	return panes
+}
+
+// a working directory or value of an environment variable with ~ and environment variables expanded
+func expandValue(value string) string {
+	expanded, err := expandPath(value)
 	if err != nil {
-		color.Error.Printf("Problem parsing opening state of yakuake window. Value: '%s'. %v\n", isShownOutput, visibleErr)
-		return false
+		return value
 	}
-	return parseBool
+	return expanded
 }
 
-// wrapper method to execute a command in a specific terminal
-func executeCommandInTerminal(command string, terminalID string) {
-	color.Info.Printf("Execute command '%s' in terminal #%s\n", command, terminalID)
-	executeCmdVoid(DbusPathSessions, DbusMethodRunCommandInTerminal, terminalID, command)
+// the command changing to the working directory and exporting the environment variables of a pane, pane may be nil.
+// It is empty if there is nothing to set up. yakuake can't start a terminal in a directory or with an environment, so
+// the command is typed into the shell like any other. It starts with a space, which keeps it out of the history only
+// if the shell is configured to ignore such commands.
+func paneSetupCommand(tab *TabDescription, pane *PaneDescription) string {
+	workdir := tab.Workdir
+	env := map[string]string{}
+	for name, value := range tab.Env {
+		env[name] = value
+	}
+	if pane != nil {
+		if len(pane.Workdir) > 0 {
+			workdir = pane.Workdir
+		}
+		for name, value := range pane.Env {
+			env[name] = value
+		}
+	}
+	var steps []string
+	if len(workdir) > 0 {
+		steps = append(steps, changeDirectoryCommand(expandValue(workdir)))
+	}
+	if len(env) > 0 {
+		var assignments []string
+		for _, name := range sortedKeys(env) {
+			assignments = append(assignments, name+"="+shellQuote(expandValue(env[name])))
+		}
+		steps = append(steps, "export "+strings.Join(assignments, " "))
+	}
+	if len(steps) == 0 {
+		return ""
+	}
+	return " " + strings.Join(steps, "; ")
 }
 
-// start new session (open a new tab) depending on split settings of this tab
-func startSession(tab *TabDescription) *string {
+// start new session (open a new tab) depending on split settings of this tab, tabs with a layout start with a single terminal
+func startSession(tab *TabDescription) (int, error) {
+	if tab.effectiveLayout() != nil {
+		return yakuake.AddSession()
+	}
 	switch strings.ToLower(tab.SplitMode) {
 	case "left-right", "horizontal", "lr":
-		sessionID, _ := executeCmd(DbusPathSessions, DbusMethodAddSessionLr)
-		return &sessionID
+		return yakuake.AddSessionTwoHorizontal()
 	case "top-bottom", "vertical", "tb":
-		sessionID, _ := executeCmd(DbusPathSessions, DbusMethodAddSessionTb)
-		return &sessionID
+		return yakuake.AddSessionTwoVertical()
 	case "quad", "qu":
-		sessionID, _ := executeCmd(DbusPathSessions, DbusMethodAddSessionQu)
-		return &sessionID
+		return yakuake.AddSessionQuad()
 	default:
 		// open single session
-		sessionID, _ := executeCmd(DbusPathSessions, DbusMethodAddSession)
-		return &sessionID
+		return yakuake.AddSession()
 	}
 }
 
 // get tab title by session's id
-func getTitleOfSession(sessionID string) *string {
-	titleOutput, _ := executeCmd(DbusPathTabs, DbusMethodTabTitle, sessionID)
-	return &titleOutput
+func getTitleOfSession(sessionID int) string {
+	title, _ := yakuake.TabTitle(sessionID)
+	return title
 }
 
 // check if terminal and its sessions can be closed by this tool
-func isTerminalClosable(terminalID string) (bool, *string) {
-	sessionsIDOutput := getSessionIDForTerminalID(terminalID)
-	sessionIDs := strings.Split(sessionsIDOutput, ",")
-	for _, sessionID := range sessionIDs {
-		title := getTitleOfSession(sessionID)
-		out, err := executeCmd(DbusPathSessions, DbusMethodIsSessionClosable, sessionID)
-		if err != nil {
-			color.Error.Printf("Error fetching closable information of session '%s'\n", sessionID)
-			return false, title
-		}
-		isClosable, _ := strconv.ParseBool(out)
-		if !isClosable {
-			return false, title
-		}
-	}
-	return true, nil
-}
-
-// get session id by terminal id
-func getSessionIDForTerminalID(terminalID string) string {
-	output, err := executeCmd(DbusPathSessions, DbusMethodSessionIDForTerminalID, terminalID)
+func isTerminalClosable(terminalID int) (bool, string) {
+	sessionID := getSessionIDForTerminalID(terminalID)
+	title := getTitleOfSession(sessionID)
+	isClosable, err := yakuake.IsSessionClosable(sessionID)
 	if err != nil {
-		color.Error.Printf("Error %v\n", err)
-		return ""
+		color.Error.Printf("Error fetching closable information of session '%d'\n", sessionID)
+		return false, title
 	}
-	return output
+	return isClosable, title
 }
 
-// method wrapper to execute all the dbus commands
-func executeCmd(args ...string) (string, error) {
-	arguments := append([]string{DbusService}, args...)
-	cmd := exec.Command(DbusApp, arguments...)
-	out, err := cmd.Output()
+// get session id by terminal id, -1 if it is unknown
+func getSessionIDForTerminalID(terminalID int) int {
+	sessionID, err := yakuake.SessionIDForTerminalID(terminalID)
 	if err != nil {
-		color.Error.Println(err.Error())
-		return "", err
+		color.Error.Printf("Error %v\n", err)
+		return -1
 	}
-	return strings.Trim(string(out), "\n"), nil
+	return sessionID
 }
 
-// execute dbus cmd without using the output, errors are printed
-func executeCmdVoid(args ...string) {
-	_, err := executeCmd(args...)
+// print errors of calls whose output is not used
+func warnOnError(err error) {
 	if err != nil {
 		color.Warn.Println(err.Error())
-		return
 	}
-	return
 }
@@ -0,0 +1,463 @@
+/*
+ * yakctl - control the yakuake terminal
+ *
+ * 2020  emschu https://github.com/emschu/yakctl
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/emschu/yakctl/internal/fakeyakuake"
+	"github.com/gookit/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// the simulated instance has to offer everything yakctl uses
+var _ Yakuake = (*fakeyakuake.Yakuake)(nil)
+
+// replace the yakuake backend by a simulated instance with one open shell, the one yakctl is running in
+func newFakeYakuake(t *testing.T) *fakeyakuake.Yakuake {
+	t.Helper()
+	fake := fakeyakuake.New()
+	if _, err := fake.AddSession(); err != nil {
+		t.Fatal(err)
+	}
+	yakuake = fake
+	t.Cleanup(func() {
+		yakuake = nil
+	})
+	return fake
+}
+
+// capture the colored output of the tool
+func captureOutput(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	color.SetOutput(buf)
+	t.Cleanup(color.ResetOutput)
+	return buf
+}
+
+func readTestConfig(t *testing.T, content string) *YakCtlConfiguration {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), ".yakctl.yml")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	configuration, err := ReadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return configuration
+}
+
+func sessionByTitle(t *testing.T, fake *fakeyakuake.Yakuake, title string) fakeyakuake.Session {
+	t.Helper()
+	for _, session := range fake.Sessions() {
+		if session.Title == title {
+			return session
+		}
+	}
+	t.Fatalf("no session with title '%s' found in\n%s", title, fake)
+	return fakeyakuake.Session{}
+}
+
+func TestLoadSessionExampleConfiguration(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	configuration, err := ReadConfig(".yakctl.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadSession(configuration, "default"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the profile clears everything, including the shell we were running in
+	sessions := fake.Sessions()
+	var titles []string
+	for _, session := range sessions {
+		titles = append(titles, session.Title)
+	}
+	expectedTitles := []string{"raspi1_ssh", "raspi2_ssh", "left-right split terminal", "top-bottom split terminal", "quad_tab", "go-shell"}
+	if !reflect.DeepEqual(titles, expectedTitles) {
+		t.Fatalf("unexpected tabs %v, expected %v", titles, expectedTitles)
+	}
+	if !fake.WindowVisible() {
+		t.Error("window should be shown after loading a profile")
+	}
+
+	raspi1 := sessionByTitle(t, fake, "raspi1_ssh")
+	if raspi1.Closable || !raspi1.MonitorSilence || !raspi1.MonitorActivity || raspi1.KeyboardInputEnabled {
+		t.Errorf("flags of raspi1_ssh not applied: %+v", raspi1)
+	}
+	expectedCommands := []string{"ssh pi@10.10.10.11", "echo 'hello world says the pi'"}
+	if commands := fake.Commands(raspi1.Terminals[0]); !reflect.DeepEqual(commands, expectedCommands) {
+		t.Errorf("unexpected commands %v", commands)
+	}
+
+	leftRight := sessionByTitle(t, fake, "left-right split terminal")
+	if len(leftRight.Terminals) != 2 {
+		t.Fatalf("expected 2 terminals, got %v", leftRight.Terminals)
+	}
+	if commands := fake.Commands(leftRight.Terminals[0]); !reflect.DeepEqual(commands, []string{"cd /var/www/html", "top"}) {
+		t.Errorf("unexpected commands of terminal1 %v", commands)
+	}
+	if commands := fake.Commands(leftRight.Terminals[1]); !reflect.DeepEqual(commands, []string{"cd /var/www/html", "htop"}) {
+		t.Errorf("unexpected commands of terminal2 %v", commands)
+	}
+
+	quad := sessionByTitle(t, fake, "quad_tab")
+	if len(quad.Terminals) != 4 {
+		t.Fatalf("expected 4 terminals, got %v", quad.Terminals)
+	}
+	expectedQuadCommands := [][]string{
+		{"echo 'all'", `echo "terminal1"`},
+		{"echo 'all'"},
+		{"echo 'all'", `echo "terminal3"`},
+		{"echo 'all'", `echo "terminal4"`},
+	}
+	for i, terminalID := range quad.Terminals {
+		if commands := fake.Commands(terminalID); !reflect.DeepEqual(commands, expectedQuadCommands[i]) {
+			t.Errorf("unexpected commands of terminal%d: %v", i+1, commands)
+		}
+	}
+}
+
+func TestLoadSessionPanes(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.Mkdir(filepath.Join(home, "src"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	configuration := readTestConfig(t, `
+profiles:
+  - name: work
+    tabs:
+      - name: panes
+        split: quad
+        commands:
+          - echo all
+        panes:
+          - name: editor
+            workdir: ~/src
+            commands: [vim]
+          - disableInput: true
+            commands: [htop]
+        terminal1:
+          - git status
+        terminal4:
+          - top
+`)
+	if err := LoadSession(configuration, "work"); err != nil {
+		t.Fatal(err)
+	}
+
+	session := sessionByTitle(t, fake, "panes")
+	expectedCommands := [][]string{
+		{" " + changeDirectoryCommand(filepath.Join(home, "src")), "echo all", "vim", "git status"},
+		{"echo all", "htop"},
+		{"echo all"},
+		{"echo all", "top"},
+	}
+	for i, terminalID := range session.Terminals {
+		if commands := fake.Commands(terminalID); !reflect.DeepEqual(commands, expectedCommands[i]) {
+			t.Errorf("unexpected commands of pane %d: %v", i+1, commands)
+		}
+		enabled, _ := fake.IsTerminalKeyboardInputEnabled(terminalID)
+		if enabled == (i == 1) {
+			t.Errorf("unexpected keyboard input of pane %d: %v", i+1, enabled)
+		}
+	}
+}
+
+func TestLoadSessionWorkdirAndEnv(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	dir := t.TempDir()
+	t.Setenv("PROJECT", dir)
+	configuration := readTestConfig(t, `
+profiles:
+  - name: work
+    tabs:
+      - name: env
+        split: lr
+        workdir: $PROJECT
+        env:
+          STAGE: dev
+          GREETING: hello world
+        commands:
+          - make
+        panes:
+          - {}
+          - workdir: /
+            env:
+              STAGE: prod
+`)
+	if err := LoadSession(configuration, "work"); err != nil {
+		t.Fatal(err)
+	}
+
+	session := sessionByTitle(t, fake, "env")
+	expectedCommands := [][]string{
+		{" " + changeDirectoryCommand(dir) + "; export GREETING='hello world' STAGE=dev", "make"},
+		{" cd /; export GREETING='hello world' STAGE=prod", "make"},
+	}
+	for i, terminalID := range session.Terminals {
+		if commands := fake.Commands(terminalID); !reflect.DeepEqual(commands, expectedCommands[i]) {
+			t.Errorf("unexpected commands of pane %d: %v", i+1, commands)
+		}
+	}
+}
+
+func TestLoadSessionWithoutClear(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	fake.SetWindowVisible(true)
+	configuration, err := ReadConfig(".yakctl.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadSession(configuration, "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := fake.Sessions()
+	if len(sessions) != 2 {
+		t.Fatalf("expected the existing and one new session, got\n%s", fake)
+	}
+	if sessions[1].Title != "raspi3_ssh" || sessions[1].Closable {
+		t.Errorf("unexpected new session %+v", sessions[1])
+	}
+	if !fake.WindowVisible() {
+		t.Error("a visible window must not be toggled")
+	}
+}
+
+func TestLoadSessionKeepsProtectedTabs(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	protectedID, _ := fake.AddSession()
+	_ = fake.SetSessionClosable(protectedID, false)
+	configuration := readTestConfig(t, `
+profiles:
+  - name: cleanup
+    clear: true
+    tabs:
+      - name: new
+`)
+
+	if err := LoadSession(configuration, "cleanup"); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := fake.Sessions()
+	if len(sessions) != 2 || sessions[0].ID != protectedID || sessions[1].Title != "new" {
+		t.Errorf("only the protected and the new session should be left, got\n%s", fake)
+	}
+}
+
+func TestLoadSessionInvalidProfile(t *testing.T) {
+	newFakeYakuake(t)
+	captureOutput(t)
+	configuration, err := ReadConfig(".yakctl.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadSession(configuration, "3"); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+}
+
+func TestLoadSessionFailingSessionCreation(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	fake.SetError("AddSession", errors.New("no more tabs"))
+	configuration := readTestConfig(t, `
+profiles:
+  - name: failing
+    tabs:
+      - name: tab
+`)
+
+	if err := LoadSession(configuration, "1"); err == nil {
+		t.Error("expected an error if the session can't be created")
+	}
+}
+
+func TestClearSession(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	_, _ = fake.AddSessionQuad()
+	protectedID, _ := fake.AddSession()
+	_ = fake.SetSessionClosable(protectedID, false)
+	fake.SetActiveSession(0)
+
+	ClearSession(false)
+
+	sessions := fake.Sessions()
+	if len(sessions) != 1 || sessions[0].ID != protectedID {
+		t.Errorf("only the protected session should be left, got\n%s", fake)
+	}
+}
+
+func TestClearSessionForced(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	_, _ = fake.AddSessionTwoVertical()
+	protectedID, _ := fake.AddSession()
+	_ = fake.SetSessionClosable(protectedID, false)
+
+	ClearSession(true)
+
+	if sessions := fake.Sessions(); len(sessions) != 0 {
+		t.Errorf("all sessions should be closed, got\n%s", fake)
+	}
+}
+
+func TestExecuteCommand(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	_, _ = fake.AddSessionTwoHorizontal()
+
+	ExecuteCommand("uptime", &[]int{})
+	for _, terminalID := range []int{0, 1, 2} {
+		if commands := fake.Commands(terminalID); !reflect.DeepEqual(commands, []string{"uptime"}) {
+			t.Errorf("unexpected commands in terminal #%d: %v", terminalID, commands)
+		}
+	}
+
+	ExecuteCommand("whoami", &[]int{2})
+	if commands := fake.Commands(2); !reflect.DeepEqual(commands, []string{"uptime", "whoami"}) {
+		t.Errorf("unexpected commands in terminal #2: %v", commands)
+	}
+	if commands := fake.Commands(1); !reflect.DeepEqual(commands, []string{"uptime"}) {
+		t.Errorf("unexpected commands in terminal #1: %v", commands)
+	}
+}
+
+func TestLoadSessions(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	protectedID, _ := fake.AddSession()
+	_ = fake.SetSessionClosable(protectedID, false)
+	configuration := readTestConfig(t, `
+profiles:
+  - name: backend
+    tabs:
+      - name: api
+      - name: db
+  - name: monitoring
+    clear: true
+    tabs:
+      - name: htop
+      - name: db
+  - name: cleanup
+    clear: true
+    force: true
+    tabs:
+      - name: shell
+`)
+
+	if err := LoadSessions(configuration, []string{"backend", "monitoring"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var titles []string
+	for _, session := range fake.Sessions() {
+		titles = append(titles, session.Title)
+	}
+	// the protected session opened before survives, the duplicated db tab is opened once
+	if !reflect.DeepEqual(titles, []string{"Shell No. 2", "api", "db", "htop"}) {
+		t.Fatalf("unexpected tabs %v", titles)
+	}
+	if !fake.WindowVisible() {
+		t.Error("window should be shown")
+	}
+
+	if err := LoadSessions(configuration, []string{"monitoring", "cleanup"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	titles = nil
+	for _, session := range fake.Sessions() {
+		titles = append(titles, session.Title)
+	}
+	if !reflect.DeepEqual(titles, []string{"htop", "db", "shell"}) {
+		t.Fatalf("a forcing profile should clear all previously opened sessions once, got %v", titles)
+	}
+	if !fake.WindowVisible() {
+		t.Error("window should be toggled at most once")
+	}
+}
+
+func TestLoadSessionsClearsBeforeFirstProfile(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	otherID, _ := fake.AddSession()
+	other, _ := fake.Session(otherID)
+	fake.SetActiveSession(0)
+	recorder := newDryRunYakuake(fake)
+	yakuake = recorder
+	configuration := readTestConfig(t, "profiles:\n  - name: a\n    tabs:\n      - name: a\n  - name: b\n    clear: true\n    tabs:\n      - name: b\n")
+
+	if err := LoadSessions(configuration, []string{"a", "b"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var relevant []string
+	for _, operation := range recorder.Operations() {
+		if strings.HasPrefix(operation, "removeTerminal") || strings.HasPrefix(operation, "addSession") {
+			relevant = append(relevant, operation)
+		}
+	}
+	// the terminal of the active session yakctl possibly runs in is closed last
+	expected := []string{
+		fmt.Sprintf("removeTerminal(%d)", other.Terminals[0]),
+		"addSession() = 1000000",
+		"addSession() = 1000002",
+		"removeTerminal(0)",
+	}
+	if !reflect.DeepEqual(relevant, expected) {
+		t.Errorf("expected the sessions to be cleared before the first profile %q, got %q", expected, relevant)
+	}
+}
+
+func TestLoadSessionsUnknownProfile(t *testing.T) {
+	fake := newFakeYakuake(t)
+	captureOutput(t)
+	configuration, err := ReadConfig(".yakctl.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadSessions(configuration, []string{"default", "missing"}, nil); err == nil {
+		t.Fatal("expected an error for an unknown profile")
+	}
+	if len(fake.Sessions()) != 1 {
+		t.Errorf("no tab should be opened if a profile is unknown, got\n%s", fake)
+	}
+}